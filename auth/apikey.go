@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type APIKeyAuthenticator struct {
+	mu      sync.RWMutex
+	keys    map[string]Identity
+	extract TokenExtractor
+}
+
+type APIKeyOption func(*APIKeyAuthenticator)
+
+func WithAPIKey(key string, identity Identity) APIKeyOption {
+	return func(a *APIKeyAuthenticator) {
+		a.keys[key] = identity
+	}
+}
+
+func WithAPIKeyExtractor(extract TokenExtractor) APIKeyOption {
+	return func(a *APIKeyAuthenticator) {
+		a.extract = extract
+	}
+}
+
+// NewAPIKeyAuthenticator authenticates the static api keys, the key is read from the `X-API-Key` header
+// or the `api_key` query parameter by default.
+func NewAPIKeyAuthenticator(options ...APIKeyOption) *APIKeyAuthenticator {
+	a := &APIKeyAuthenticator{
+		keys:    make(map[string]Identity),
+		extract: Extractors(FromHeader("X-API-Key", ""), FromQuery("api_key")),
+	}
+	for _, option := range options {
+		option(a)
+	}
+	return a
+}
+
+// Set adds or replaces an api key.
+func (a *APIKeyAuthenticator) Set(key string, identity Identity) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.keys[key] = identity
+}
+
+// Revoke removes an api key.
+func (a *APIKeyAuthenticator) Revoke(key string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.keys, key)
+}
+
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	return authenticateRequest(r, a.extract, a)
+}
+
+func (a *APIKeyAuthenticator) AuthenticateToken(ctx context.Context, token string) (*Identity, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for key, identity := range a.keys {
+		// constant time comparison, avoid leaking the key by timing
+		if subtle.ConstantTimeCompare([]byte(key), []byte(token)) == 1 {
+			if identity.Expired(time.Now()) {
+				return nil, ErrCredentialsExpired
+			}
+			return &identity, nil
+		}
+	}
+	return nil, ErrInvalidCredentials
+}
@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+)
+
+var (
+	ErrNoCredentials      = errors.New("no credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrCredentialsExpired = errors.New("credentials expired")
+	ErrInsufficientScope  = errors.New("insufficient scope")
+)
+
+// Identity is the structured result of a successful authentication.
+type Identity struct {
+	ID        string
+	Tenant    string
+	Device    string
+	Scopes    []string
+	ExpiresAt time.Time
+	Claims    map[string]any
+}
+
+// clone copies the identity with its scopes and claims, the claim values are shared.
+func (i *Identity) clone() *Identity {
+	if i == nil {
+		return nil
+	}
+	c := *i
+	c.Scopes = slices.Clone(i.Scopes)
+	c.Claims = maps.Clone(i.Claims)
+	return &c
+}
+
+func (i *Identity) HasScope(scope string) bool {
+	return slices.Contains(i.Scopes, scope)
+}
+
+// Expired reports whether the identity has an expiry, and it is before now.
+func (i *Identity) Expired(now time.Time) bool {
+	return !i.ExpiresAt.IsZero() && !now.Before(i.ExpiresAt)
+}
+
+type (
+	// Authenticator admits a connection by its handshake request.
+	Authenticator interface {
+		Authenticate(r *http.Request) (*Identity, error)
+	}
+
+	AuthenticatorFunc func(r *http.Request) (*Identity, error)
+
+	// TokenAuthenticator verifies a bare credential, it is used when the credential
+	// does not come with a http request, e.g. an in-band re-authentication.
+	TokenAuthenticator interface {
+		AuthenticateToken(ctx context.Context, token string) (*Identity, error)
+	}
+)
+
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (*Identity, error) {
+	return f(r)
+}
+
+// FromFunc converts the legacy id-only auth function to an Authenticator.
+func FromFunc(f func(r *http.Request) (string, error)) Authenticator {
+	return AuthenticatorFunc(func(r *http.Request) (*Identity, error) {
+		id, err := f(r)
+		if err != nil {
+			return nil, err
+		}
+		return &Identity{ID: id}, nil
+	})
+}
+
+// Func converts an Authenticator to the id-only auth function taken by the listeners.
+func Func(a Authenticator) func(r *http.Request) (string, error) {
+	return func(r *http.Request) (string, error) {
+		identity, err := a.Authenticate(r)
+		if err != nil {
+			return "", err
+		}
+		return identity.ID, nil
+	}
+}
+
+type anyAuthenticator []Authenticator
+
+// Any tries the authenticators in order and returns the first admitted identity.
+func Any(authenticators ...Authenticator) Authenticator {
+	return anyAuthenticator(authenticators)
+}
+
+func (as anyAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	var err error
+	for _, a := range as {
+		identity, e := a.Authenticate(r)
+		if e == nil {
+			return identity, nil
+		}
+		err = errors.Join(err, e)
+	}
+	if err == nil {
+		return nil, ErrNoCredentials
+	}
+	return nil, err
+}
+
+func (as anyAuthenticator) AuthenticateToken(ctx context.Context, token string) (*Identity, error) {
+	var err error
+	for _, a := range as {
+		ta, ok := a.(TokenAuthenticator)
+		if !ok {
+			continue
+		}
+		identity, e := ta.AuthenticateToken(ctx, token)
+		if e == nil {
+			return identity, nil
+		}
+		err = errors.Join(err, e)
+	}
+	if err == nil {
+		return nil, ErrInvalidCredentials
+	}
+	return nil, err
+}
+
+type scopedAuthenticator struct {
+	Authenticator
+	scopes []string
+}
+
+// RequireScopes rejects the identities which do not have all the scopes.
+func RequireScopes(a Authenticator, scopes ...string) Authenticator {
+	return &scopedAuthenticator{Authenticator: a, scopes: scopes}
+}
+
+func (s *scopedAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	identity, err := s.Authenticator.Authenticate(r)
+	if err != nil {
+		return nil, err
+	}
+	return s.check(identity)
+}
+
+func (s *scopedAuthenticator) AuthenticateToken(ctx context.Context, token string) (*Identity, error) {
+	ta, ok := s.Authenticator.(TokenAuthenticator)
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	identity, err := ta.AuthenticateToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return s.check(identity)
+}
+
+func (s *scopedAuthenticator) check(identity *Identity) (*Identity, error) {
+	for _, scope := range s.scopes {
+		if !identity.HasScope(scope) {
+			return nil, ErrInsufficientScope
+		}
+	}
+	return identity, nil
+}
@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWTAuthenticator verifies the HMAC (HS*), RSA (RS*, PS*) and ECDSA (ES*) signed JWTs.
+// The subject of the token is the id of the identity.
+type JWTAuthenticator struct {
+	secret  []byte
+	rsaKey  *rsa.PublicKey
+	ecKey   *ecdsa.PublicKey
+	keySet  *KeySet
+	extract TokenExtractor
+
+	parserOptions []jwt.ParserOption
+
+	tenantClaim string
+	deviceClaim string
+}
+
+type JWTOption func(*JWTAuthenticator)
+
+func WithHMACSecret(secret []byte) JWTOption {
+	return func(a *JWTAuthenticator) {
+		a.secret = secret
+	}
+}
+
+func WithRSAPublicKey(key *rsa.PublicKey) JWTOption {
+	return func(a *JWTAuthenticator) {
+		a.rsaKey = key
+	}
+}
+
+func WithECDSAPublicKey(key *ecdsa.PublicKey) JWTOption {
+	return func(a *JWTAuthenticator) {
+		a.ecKey = key
+	}
+}
+
+// WithKeySet verifies the tokens by the key of their `kid` header, see LoadKeySet.
+func WithKeySet(ks *KeySet) JWTOption {
+	return func(a *JWTAuthenticator) {
+		a.keySet = ks
+	}
+}
+
+func WithJWTExtractor(extract TokenExtractor) JWTOption {
+	return func(a *JWTAuthenticator) {
+		a.extract = extract
+	}
+}
+
+func WithIssuer(issuer string) JWTOption {
+	return func(a *JWTAuthenticator) {
+		a.parserOptions = append(a.parserOptions, jwt.WithIssuer(issuer))
+	}
+}
+
+func WithAudience(audience string) JWTOption {
+	return func(a *JWTAuthenticator) {
+		a.parserOptions = append(a.parserOptions, jwt.WithAudience(audience))
+	}
+}
+
+func WithLeeway(leeway time.Duration) JWTOption {
+	return func(a *JWTAuthenticator) {
+		a.parserOptions = append(a.parserOptions, jwt.WithLeeway(leeway))
+	}
+}
+
+// WithClaimNames sets the claims of the tenant and the device, they are `tenant` and `device` by default.
+func WithClaimNames(tenant, device string) JWTOption {
+	return func(a *JWTAuthenticator) {
+		a.tenantClaim = tenant
+		a.deviceClaim = device
+	}
+}
+
+// NewJWTAuthenticator creates a JWT authenticator, the token is extracted by DefaultTokenExtractor by default.
+func NewJWTAuthenticator(options ...JWTOption) *JWTAuthenticator {
+	a := &JWTAuthenticator{
+		extract:     DefaultTokenExtractor(),
+		tenantClaim: "tenant",
+		deviceClaim: "device",
+	}
+	for _, option := range options {
+		option(a)
+	}
+	a.parserOptions = append(a.parserOptions, jwt.WithExpirationRequired())
+	return a
+}
+
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	return authenticateRequest(r, a.extract, a)
+}
+
+func (a *JWTAuthenticator) AuthenticateToken(ctx context.Context, token string) (*Identity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, a.key, a.parserOptions...)
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, ErrCredentialsExpired
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+	return a.identity(claims)
+}
+
+func (a *JWTAuthenticator) key(token *jwt.Token) (any, error) {
+	if kid, ok := token.Header["kid"].(string); ok && a.keySet != nil {
+		key, ok := a.keySet.Key(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		return checkKey(token.Method, key)
+	}
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		return checkKey(token.Method, a.secret)
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		return checkKey(token.Method, a.rsaKey)
+	case *jwt.SigningMethodECDSA:
+		return checkKey(token.Method, a.ecKey)
+	}
+	return nil, fmt.Errorf("unsupported signing method %s", token.Method.Alg())
+}
+
+// checkKey makes sure the key matches the signing method, so that a public key can never be used as
+// an HMAC secret.
+func checkKey(method jwt.SigningMethod, key any) (any, error) {
+	ok := false
+	switch method.(type) {
+	case *jwt.SigningMethodHMAC:
+		k, is := key.([]byte)
+		ok = is && len(k) > 0
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		k, is := key.(*rsa.PublicKey)
+		ok = is && k != nil
+	case *jwt.SigningMethodECDSA:
+		k, is := key.(*ecdsa.PublicKey)
+		ok = is && k != nil
+	}
+	if !ok {
+		return nil, fmt.Errorf("no key for signing method %s", method.Alg())
+	}
+	return key, nil
+}
+
+func (a *JWTAuthenticator) identity(claims jwt.MapClaims) (*Identity, error) {
+	sub, err := claims.GetSubject()
+	if err != nil || sub == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidCredentials)
+	}
+	identity := &Identity{ID: sub, Claims: claims}
+	identity.Tenant, _ = claims[a.tenantClaim].(string)
+	identity.Device, _ = claims[a.deviceClaim].(string)
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		identity.ExpiresAt = exp.Time
+	}
+	if scopes, ok := claims["scope"].(string); ok {
+		identity.Scopes = strings.Fields(scopes)
+	}
+	if scopes, ok := claims["scopes"].([]any); ok {
+		for _, scope := range scopes {
+			if s, ok := scope.(string); ok {
+				identity.Scopes = append(identity.Scopes, s)
+			}
+		}
+	}
+	return identity, nil
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	// DefaultSubprotocol is the marker protocol of FromSubprotocol. Browsers can not set the
+	// Authorization header of a websocket handshake, so the token is carried as
+	// `Sec-WebSocket-Protocol: bearer, <token>`, and the server answers with `bearer`.
+	DefaultSubprotocol = "bearer"
+)
+
+// TokenExtractor finds the credential in a handshake request.
+type TokenExtractor func(r *http.Request) (string, bool)
+
+// FromHeader extracts the token from the header, the scheme (e.g. Bearer) is stripped if it is not empty.
+func FromHeader(name, scheme string) TokenExtractor {
+	return func(r *http.Request) (string, bool) {
+		val := strings.TrimSpace(r.Header.Get(name))
+		if scheme != "" {
+			n := len(scheme)
+			if len(val) <= n || !strings.EqualFold(val[:n], scheme) || val[n] != ' ' {
+				return "", false
+			}
+			val = strings.TrimSpace(val[n+1:])
+		}
+		return val, val != ""
+	}
+}
+
+// FromBearer extracts the token from `Authorization: Bearer <token>`.
+func FromBearer() TokenExtractor {
+	return FromHeader("Authorization", "Bearer")
+}
+
+// FromQuery extracts the token from the query string.
+func FromQuery(name string) TokenExtractor {
+	return func(r *http.Request) (string, bool) {
+		val := r.URL.Query().Get(name)
+		return val, val != ""
+	}
+}
+
+// FromSubprotocol extracts the token following the marker protocol in the Sec-WebSocket-Protocol header.
+// The listener must accept the marker as a subprotocol, see DefaultSubprotocol.
+func FromSubprotocol(marker string) TokenExtractor {
+	return func(r *http.Request) (string, bool) {
+		var protocols []string
+		for _, val := range r.Header.Values("Sec-WebSocket-Protocol") {
+			for _, p := range strings.Split(val, ",") {
+				protocols = append(protocols, strings.TrimSpace(p))
+			}
+		}
+		for i, p := range protocols {
+			if p == marker && i+1 < len(protocols) && protocols[i+1] != "" {
+				return protocols[i+1], true
+			}
+		}
+		return "", false
+	}
+}
+
+// Extractors tries the extractors in order.
+func Extractors(extractors ...TokenExtractor) TokenExtractor {
+	return func(r *http.Request) (string, bool) {
+		for _, extract := range extractors {
+			if token, ok := extract(r); ok {
+				return token, true
+			}
+		}
+		return "", false
+	}
+}
+
+// DefaultTokenExtractor looks up the Authorization header, the `access_token` query parameter
+// and the Sec-WebSocket-Protocol header in order.
+func DefaultTokenExtractor() TokenExtractor {
+	return Extractors(FromBearer(), FromQuery("access_token"), FromSubprotocol(DefaultSubprotocol))
+}
+
+// authenticateRequest extracts the token and verifies it by the TokenAuthenticator.
+func authenticateRequest(r *http.Request, extract TokenExtractor, a TokenAuthenticator) (*Identity, error) {
+	token, ok := extract(r)
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	return a.AuthenticateToken(r.Context(), token)
+}
@@ -0,0 +1,298 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type (
+	// WebhookRequest is posted to the endpoint for each connection admission.
+	// Token is set instead of the request fields when it is an in-band re-authentication.
+	WebhookRequest struct {
+		Method     string              `json:"method,omitempty"`
+		Path       string              `json:"path,omitempty"`
+		Header     map[string][]string `json:"header,omitempty"`
+		Query      map[string][]string `json:"query,omitempty"`
+		RemoteAddr string              `json:"remote_addr,omitempty"`
+		Token      string              `json:"token,omitempty"`
+	}
+
+	// WebhookResponse is the answer of the endpoint, the connection is admitted only if Allow is true.
+	WebhookResponse struct {
+		Allow     bool           `json:"allow"`
+		Reason    string         `json:"reason,omitempty"`
+		ID        string         `json:"id"`
+		Tenant    string         `json:"tenant,omitempty"`
+		Device    string         `json:"device,omitempty"`
+		Scopes    []string       `json:"scopes,omitempty"`
+		ExpiresAt time.Time      `json:"expires_at"`
+		Claims    map[string]any `json:"claims,omitempty"`
+	}
+)
+
+// WebhookAuthenticator delegates the admission to an external http endpoint.
+type WebhookAuthenticator struct {
+	endpoint string
+	client   *http.Client
+	timeout  time.Duration
+
+	positiveTTL time.Duration
+	negativeTTL time.Duration
+	cacheSize   int
+	cacheKey    func(r *http.Request) string
+	cache       *resultCache
+
+	// failOpen extracts the id when the endpoint is unavailable, nil means fail-closed
+	failOpen TokenExtractor
+}
+
+type WebhookOption func(*WebhookAuthenticator)
+
+func WithWebhookClient(client *http.Client) WebhookOption {
+	return func(a *WebhookAuthenticator) {
+		a.client = client
+	}
+}
+
+func WithWebhookTimeout(timeout time.Duration) WebhookOption {
+	return func(a *WebhookAuthenticator) {
+		a.timeout = timeout
+	}
+}
+
+// WithWebhookCache caches the allowed results for positive and the denied results for negative,
+// zero disables the cache of the kind. The expiry of the identity is always respected.
+func WithWebhookCache(positive, negative time.Duration, size int) WebhookOption {
+	return func(a *WebhookAuthenticator) {
+		a.positiveTTL = positive
+		a.negativeTTL = negative
+		a.cacheSize = size
+	}
+}
+
+// WithWebhookCacheKey sets the function which identifies the credentials of a request, an empty key
+// is never cached. By default, the key is the digest of the Authorization, Cookie, X-API-Key and
+// Sec-WebSocket-Protocol headers, the query string and the path.
+func WithWebhookCacheKey(key func(r *http.Request) string) WebhookOption {
+	return func(a *WebhookAuthenticator) {
+		a.cacheKey = key
+	}
+}
+
+// WithWebhookFailOpen admits the connection when the endpoint is unavailable, the id is extracted from
+// the request by the extractor. The authenticator is fail-closed by default.
+func WithWebhookFailOpen(id TokenExtractor) WebhookOption {
+	return func(a *WebhookAuthenticator) {
+		a.failOpen = id
+	}
+}
+
+func NewWebhookAuthenticator(endpoint string, options ...WebhookOption) *WebhookAuthenticator {
+	a := &WebhookAuthenticator{
+		endpoint:    endpoint,
+		client:      http.DefaultClient,
+		timeout:     3 * time.Second,
+		positiveTTL: time.Minute,
+		negativeTTL: 10 * time.Second,
+		cacheSize:   10000,
+		cacheKey:    defaultCacheKey,
+	}
+	for _, option := range options {
+		option(a)
+	}
+	a.cache = newResultCache(a.cacheSize)
+	return a
+}
+
+func (a *WebhookAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	req := &WebhookRequest{
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Header:     r.Header,
+		Query:      r.URL.Query(),
+		RemoteAddr: r.RemoteAddr,
+	}
+	identity, err := a.authenticate(r.Context(), a.cacheKey(r), req)
+	if err == nil || a.failOpen == nil || !isUnavailable(err) {
+		return identity, err
+	}
+	id, ok := a.failOpen(r)
+	if !ok {
+		return nil, err
+	}
+	slog.WarnContext(r.Context(), "auth webhook is unavailable, fail open", slog.String("id", id),
+		slog.String("error", err.Error()))
+	return &Identity{ID: id}, nil
+}
+
+func (a *WebhookAuthenticator) AuthenticateToken(ctx context.Context, token string) (*Identity, error) {
+	sum := sha256.Sum256([]byte(token))
+	return a.authenticate(ctx, "token:"+hex.EncodeToString(sum[:]), &WebhookRequest{Token: token})
+}
+
+func (a *WebhookAuthenticator) authenticate(ctx context.Context, key string, req *WebhookRequest) (*Identity, error) {
+	if key != "" {
+		if res, ok := a.cache.get(key); ok {
+			// the cached identity is shared, callers get their own copy
+			return res.identity.clone(), res.err
+		}
+	}
+	identity, err := a.call(ctx, req)
+	if key == "" || isUnavailable(err) {
+		return identity, err
+	}
+	if err != nil {
+		a.cache.set(key, nil, err, time.Now().Add(a.negativeTTL))
+		return nil, err
+	}
+	expiresAt := time.Now().Add(a.positiveTTL)
+	if !identity.ExpiresAt.IsZero() && identity.ExpiresAt.Before(expiresAt) {
+		expiresAt = identity.ExpiresAt
+	}
+	a.cache.set(key, identity.clone(), nil, expiresAt)
+	return identity, nil
+}
+
+// unavailableError means the endpoint did not give an answer, it is never cached.
+type unavailableError struct {
+	err error
+}
+
+func (e *unavailableError) Error() string {
+	return "auth webhook is unavailable: " + e.err.Error()
+}
+
+func (e *unavailableError) Unwrap() error {
+	return e.err
+}
+
+func isUnavailable(err error) bool {
+	var e *unavailableError
+	return errors.As(err, &e)
+}
+
+func (a *WebhookAuthenticator) call(ctx context.Context, req *WebhookRequest) (*Identity, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, a.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := a.client.Do(httpReq)
+	if err != nil {
+		return nil, &unavailableError{err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusRequestTimeout ||
+		resp.StatusCode == http.StatusTooManyRequests {
+		return nil, &unavailableError{err: fmt.Errorf("unexpected status %s", resp.Status)}
+	}
+	res := new(WebhookResponse)
+	err = json.NewDecoder(resp.Body).Decode(res)
+	if resp.StatusCode != http.StatusOK {
+		// any other status is a denial, the body is optional
+		return nil, fmt.Errorf("%w: %s %s", ErrInvalidCredentials, resp.Status, res.Reason)
+	}
+	if err != nil {
+		return nil, &unavailableError{err: fmt.Errorf("invalid response: %w", err)}
+	}
+	if !res.Allow {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidCredentials, res.Reason)
+	}
+	if res.ID == "" {
+		return nil, fmt.Errorf("%w: no id", ErrInvalidCredentials)
+	}
+	return &Identity{
+		ID:        res.ID,
+		Tenant:    res.Tenant,
+		Device:    res.Device,
+		Scopes:    res.Scopes,
+		ExpiresAt: res.ExpiresAt,
+		Claims:    res.Claims,
+	}, nil
+}
+
+func defaultCacheKey(r *http.Request) string {
+	h := sha256.New()
+	empty := true
+	for _, name := range []string{"Authorization", "Cookie", "X-API-Key", "Sec-WebSocket-Protocol"} {
+		for _, val := range r.Header.Values(name) {
+			empty = false
+			fmt.Fprintf(h, "%s:%s\n", name, val)
+		}
+	}
+	if r.URL.RawQuery != "" {
+		empty = false
+		fmt.Fprintf(h, "?%s\n", r.URL.RawQuery)
+	}
+	if empty {
+		return ""
+	}
+	// the decision may differ between the mounted endpoints
+	fmt.Fprintf(h, "%s\n", r.URL.Path)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type cachedResult struct {
+	identity  *Identity
+	err       error
+	expiresAt time.Time
+}
+
+type resultCache struct {
+	mu      sync.Mutex
+	size    int
+	results map[string]*cachedResult
+}
+
+func newResultCache(size int) *resultCache {
+	return &resultCache{size: size, results: make(map[string]*cachedResult)}
+}
+
+func (c *resultCache) get(key string) (*cachedResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	res, ok := c.results[key]
+	if !ok {
+		return nil, false
+	}
+	if !time.Now().Before(res.expiresAt) {
+		delete(c.results, key)
+		return nil, false
+	}
+	return res, true
+}
+
+func (c *resultCache) set(key string, identity *Identity, err error, expiresAt time.Time) {
+	if c.size <= 0 || !time.Now().Before(expiresAt) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.results) >= c.size {
+		now := time.Now()
+		for k, res := range c.results {
+			if !now.Before(res.expiresAt) {
+				delete(c.results, k)
+			}
+		}
+		if len(c.results) >= c.size {
+			return
+		}
+	}
+	c.results[key] = &cachedResult{identity: identity, err: err, expiresAt: expiresAt}
+}
@@ -0,0 +1,160 @@
+package raindrop
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	CodecJSON        = "json"
+	CodecProtobuf    = "protobuf"
+	CodecMessagePack = "msgpack"
+	CodecCBOR        = "cbor"
+)
+
+var (
+	ErrCodecNotFound = errors.New("codec not found")
+	ErrTranscode     = errors.New("cannot transcode payload")
+)
+
+// Codec encodes the payload of the envelopes, the name of the codec is carried by the envelope.HeaderCodec header.
+type Codec interface {
+	Name() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+type CodecRegistry struct {
+	mu     sync.RWMutex
+	codecs map[string]Codec
+}
+
+func NewCodecRegistry(codecs ...Codec) *CodecRegistry {
+	r := &CodecRegistry{codecs: make(map[string]Codec)}
+	for _, c := range codecs {
+		r.Register(c)
+	}
+	return r
+}
+
+func (r *CodecRegistry) Register(c Codec) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.codecs[c.Name()] = c
+}
+
+func (r *CodecRegistry) Get(name string) (Codec, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrCodecNotFound, name)
+	}
+	return c, nil
+}
+
+func (r *CodecRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.codecs))
+	for name := range r.codecs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// DefaultCodecs is the registry of the built-in codecs.
+var DefaultCodecs = NewCodecRegistry(JSONCodec{}, ProtobufCodec{}, MessagePackCodec{}, CBORCodec{})
+
+func RegisterCodec(c Codec) {
+	DefaultCodecs.Register(c)
+}
+
+type JSONCodec struct{}
+
+func (JSONCodec) Name() string {
+	return CodecJSON
+}
+
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// ProtobufCodec encodes the proto.Message values as they are, and the other values as google.protobuf.Value,
+// so that a generic value (e.g. decoded from the other codecs) can be transcoded to protobuf and back.
+type ProtobufCodec struct{}
+
+func (ProtobufCodec) Name() string {
+	return CodecProtobuf
+}
+
+func (ProtobufCodec) Marshal(v any) ([]byte, error) {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Marshal(m)
+	}
+	val, err := structpb.NewValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(val)
+}
+
+func (ProtobufCodec) Unmarshal(data []byte, v any) error {
+	switch dst := v.(type) {
+	case proto.Message:
+		return proto.Unmarshal(data, dst)
+	case *any:
+		val := new(structpb.Value)
+		if err := proto.Unmarshal(data, val); err != nil {
+			return err
+		}
+		*dst = val.AsInterface()
+		return nil
+	}
+	return fmt.Errorf("protobuf codec cannot unmarshal into %T", v)
+}
+
+type MessagePackCodec struct{}
+
+func (MessagePackCodec) Name() string {
+	return CodecMessagePack
+}
+
+func (MessagePackCodec) Marshal(v any) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (MessagePackCodec) Unmarshal(data []byte, v any) error {
+	return msgpack.Unmarshal(data, v)
+}
+
+// cborDecMode decodes the maps into map[string]any, so that the generic values can be transcoded to json.
+var cborDecMode, _ = cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]any(nil))}.DecMode()
+
+type CBORCodec struct{}
+
+func (CBORCodec) Name() string {
+	return CodecCBOR
+}
+
+func (CBORCodec) Marshal(v any) ([]byte, error) {
+	return cbor.Marshal(v)
+}
+
+func (CBORCodec) Unmarshal(data []byte, v any) error {
+	return cborDecMode.Unmarshal(data, v)
+}
@@ -0,0 +1,134 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	AlgorithmGzip = "gzip"
+	AlgorithmZstd = "zstd"
+)
+
+var ErrTooLarge = errors.New("decompressed data is too large")
+
+// Algorithm compresses and decompresses the payloads.
+type Algorithm interface {
+	Name() string
+	Compress(data []byte) ([]byte, error)
+	// Decompress decompresses the data, it fails with ErrTooLarge if the result is larger than the limit.
+	Decompress(data []byte, limit int) ([]byte, error)
+}
+
+type Gzip struct {
+	Level int
+}
+
+// NewGzip creates a gzip algorithm of the compression level, e.g. gzip.DefaultCompression.
+func NewGzip(level int) *Gzip {
+	return &Gzip{Level: level}
+}
+
+func (g *Gzip) Name() string {
+	return AlgorithmGzip
+}
+
+func (g *Gzip) Compress(data []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	w, err := gzip.NewWriterLevel(buf, g.Level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (g *Gzip) Decompress(data []byte, limit int) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readLimit(r, limit)
+}
+
+// Zstd compresses the payloads by zstd, with a dictionary shared by the server and the clients.
+type Zstd struct {
+	dict    []byte
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+// NewZstd creates a zstd algorithm, the dictionary is optional and it is built by `zstd --train` from the
+// samples of the payloads. The peers must use the same dictionary.
+func NewZstd(dict []byte) (*Zstd, error) {
+	var (
+		encoderOptions []zstd.EOption
+		decoderOptions = []zstd.DOption{zstd.WithDecodeAllCapLimit(true), zstd.WithDecoderConcurrency(0)}
+	)
+	if len(dict) > 0 {
+		encoderOptions = append(encoderOptions, zstd.WithEncoderDict(dict))
+		decoderOptions = append(decoderOptions, zstd.WithDecoderDicts(dict))
+	}
+	encoder, err := zstd.NewWriter(nil, encoderOptions...)
+	if err != nil {
+		return nil, err
+	}
+	decoder, err := zstd.NewReader(nil, decoderOptions...)
+	if err != nil {
+		return nil, err
+	}
+	return &Zstd{dict: dict, encoder: encoder, decoder: decoder}, nil
+}
+
+func (z *Zstd) Name() string {
+	return AlgorithmZstd
+}
+
+func (z *Zstd) Compress(data []byte) ([]byte, error) {
+	return z.encoder.EncodeAll(data, nil), nil
+}
+
+// Decompress decodes the frames whose content size is known at once, and the others by a stream.
+func (z *Zstd) Decompress(data []byte, limit int) ([]byte, error) {
+	var h zstd.Header
+	if err := h.Decode(data); err != nil {
+		return nil, err
+	}
+	if h.HasFCS {
+		if h.FrameContentSize > uint64(limit) {
+			return nil, ErrTooLarge
+		}
+		return z.decoder.DecodeAll(data, make([]byte, 0, h.FrameContentSize))
+	}
+	options := []zstd.DOption{zstd.WithDecoderConcurrency(1)}
+	if len(z.dict) > 0 {
+		options = append(options, zstd.WithDecoderDicts(z.dict))
+	}
+	r, err := zstd.NewReader(bytes.NewReader(data), options...)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readLimit(r, limit)
+}
+
+func readLimit(r io.Reader, limit int) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > limit {
+		return nil, ErrTooLarge
+	}
+	return data, nil
+}
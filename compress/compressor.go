@@ -0,0 +1,135 @@
+package compress
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cro4k/raindrop/core"
+	"github.com/cro4k/raindrop/envelope"
+)
+
+const (
+	// Param is the handshake parameter which lists the algorithms supported by a client in the order of its
+	// preference, e.g. `?compression=zstd,gzip`.
+	Param = "compression"
+
+	DefaultThreshold = 1 << 10
+	DefaultMaxSize   = 64 << 20
+)
+
+var ErrUnknownAlgorithm = errors.New("unknown compression algorithm")
+
+// Compressor is a core.Interceptor which compresses the payloads of the outbound envelopes by the algorithm
+// negotiated by the session, and decompresses the payloads of the inbound envelopes by the algorithm in their
+// envelope.HeaderCompression header. The payloads smaller than the threshold are not compressed, nor the
+// sessions which support none of the algorithms.
+//
+// The Compressor should follow the raindrop.Transcoder, and precede the fragment.Fragmenter.
+type Compressor struct {
+	algorithms map[string]Algorithm
+	threshold  int
+	maxSize    int
+}
+
+type Option func(*Compressor)
+
+// WithAlgorithms adds the algorithms, gzip is supported by default.
+func WithAlgorithms(algorithms ...Algorithm) Option {
+	return func(c *Compressor) {
+		for _, a := range algorithms {
+			c.algorithms[a.Name()] = a
+		}
+	}
+}
+
+// WithThreshold sets the size of the payloads below which they are not compressed.
+func WithThreshold(threshold int) Option {
+	return func(c *Compressor) {
+		c.threshold = threshold
+	}
+}
+
+// WithMaxSize sets the max size of the decompressed inbound payloads.
+func WithMaxSize(size int) Option {
+	return func(c *Compressor) {
+		c.maxSize = size
+	}
+}
+
+func NewCompressor(options ...Option) *Compressor {
+	c := &Compressor{
+		algorithms: map[string]Algorithm{AlgorithmGzip: NewGzip(gzip.DefaultCompression)},
+		threshold:  DefaultThreshold,
+		maxSize:    DefaultMaxSize,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+type sessionAlgorithmKey struct{}
+
+// SessionAlgorithm returns the algorithm negotiated by the session, it is nil if the session supports none of
+// the algorithms.
+func (c *Compressor) SessionAlgorithm(s *core.Session) Algorithm {
+	if a, ok := s.Value(sessionAlgorithmKey{}); ok {
+		a, _ := a.(Algorithm)
+		return a
+	}
+	var a Algorithm
+	for _, name := range strings.Split(s.Params.Get(Param), ",") {
+		if v, ok := c.algorithms[strings.TrimSpace(name)]; ok {
+			a = v
+			break
+		}
+	}
+	s.SetValue(sessionAlgorithmKey{}, a)
+	return a
+}
+
+func (c *Compressor) Outbound(ctx context.Context, s *core.Session, data []byte) ([]byte, error) {
+	a := c.SessionAlgorithm(s)
+	if a == nil {
+		return data, nil
+	}
+	e, format, err := envelope.Decode(data)
+	if err != nil || len(e.GetPayload()) < c.threshold || e.Header(envelope.HeaderCompression) != "" {
+		return data, nil
+	}
+	payload, err := a.Compress(e.GetPayload())
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) >= len(e.GetPayload()) {
+		return data, nil
+	}
+	e.Payload = payload
+	e.SetHeader(envelope.HeaderCompression, a.Name())
+	return envelope.Encode(e, format)
+}
+
+func (c *Compressor) Inbound(ctx context.Context, s *core.Session, data []byte) ([]byte, error) {
+	e, format, err := envelope.Decode(data)
+	if err != nil {
+		return data, nil
+	}
+	name := e.Header(envelope.HeaderCompression)
+	if name == "" {
+		return data, nil
+	}
+	a, ok := c.algorithms[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownAlgorithm, name)
+	}
+	payload, err := a.Decompress(e.GetPayload(), c.maxSize)
+	if err != nil {
+		return nil, err
+	}
+	e.Payload = payload
+	delete(e.Headers, envelope.HeaderCompression)
+	return envelope.Encode(e, format)
+}
@@ -0,0 +1,216 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/cro4k/raindrop/envelope"
+)
+
+const (
+	DefaultChannelWeight   = 1
+	DefaultChannelCapacity = 256
+)
+
+var ErrFrameDropped = errors.New("frame dropped")
+
+// Channel is a logical channel of the connections, e.g. "chat". The frames of each channel are queued apart, and
+// the connection writer takes them from the queues by their weights, so that a burst in one channel does not
+// delay the others. When the queue of a channel is full, the writers wait for it, or the oldest frame is dropped
+// with ErrFrameDropped if DropOldest is set, e.g. for the live updates which are replaced by the newer ones.
+type Channel struct {
+	Name       string
+	Weight     int
+	Capacity   int
+	DropOldest bool
+}
+
+// ChannelWriter is implemented by the writers which write to a logical channel of the clients.
+type ChannelWriter interface {
+	WriteToChannel(ctx context.Context, to, channel string, data []byte) error
+}
+
+// WithChannels sets the channels of the connections, the frames of an unknown channel are written in the default
+// channel whose name is empty. Without channels, the frames are written directly by the writers.
+func WithChannels(channels ...Channel) Option {
+	return func(o *options) {
+		o.channels = append(o.channels, channels...)
+	}
+}
+
+type channelKey struct{}
+
+// WithChannel sets the channel of the frames written with the context.
+func WithChannel(ctx context.Context, channel string) context.Context {
+	return context.WithValue(ctx, channelKey{}, channel)
+}
+
+// ChannelFromContext returns the channel of the context, it is empty for the default channel.
+func ChannelFromContext(ctx context.Context) string {
+	channel, _ := ctx.Value(channelKey{}).(string)
+	return channel
+}
+
+// WriteToChannel writes the data to the channel of the client, the channel is set in the envelope if the data
+// is an envelope.
+func (s *Server) WriteToChannel(ctx context.Context, to, channel string, data []byte) error {
+	if e, format, err := envelope.Decode(data); err == nil && e.GetChannel() != channel {
+		e.Channel = channel
+		if data, err = envelope.Encode(e, format); err != nil {
+			return err
+		}
+	}
+	return s.WriteTo(WithChannel(ctx, channel), to, data)
+}
+
+type queuedFrame struct {
+	ctx  context.Context
+	data []byte
+	done chan error
+}
+
+type channelQueue struct {
+	Channel
+	frames []*queuedFrame
+	space  chan struct{}
+	// current is the current weight of the smooth weighted round-robin.
+	current int
+}
+
+// scheduler queues the frames of a connection by their channels, and writes them in a single goroutine.
+type scheduler struct {
+	write func(ctx context.Context, data []byte) error
+
+	mu       sync.Mutex
+	queues   map[string]*channelQueue
+	fallback *channelQueue
+	notify   chan struct{}
+	closed   chan struct{}
+}
+
+func newScheduler(channels []Channel, write func(ctx context.Context, data []byte) error) *scheduler {
+	sc := &scheduler{
+		write:  write,
+		queues: make(map[string]*channelQueue),
+		notify: make(chan struct{}, 1),
+		closed: make(chan struct{}),
+	}
+	for _, c := range append([]Channel{{}}, channels...) {
+		if c.Weight <= 0 {
+			c.Weight = DefaultChannelWeight
+		}
+		if c.Capacity <= 0 {
+			c.Capacity = DefaultChannelCapacity
+		}
+		sc.queues[c.Name] = &channelQueue{Channel: c, space: make(chan struct{}, 1)}
+	}
+	sc.fallback = sc.queues[""]
+	return sc
+}
+
+// send queues the frame in its channel, and waits until it is written.
+func (sc *scheduler) send(ctx context.Context, data []byte) error {
+	q, ok := sc.queues[ChannelFromContext(ctx)]
+	if !ok {
+		q = sc.fallback
+	}
+	f := &queuedFrame{ctx: ctx, data: data, done: make(chan error, 1)}
+	if err := sc.push(ctx, q, f); err != nil {
+		return err
+	}
+	select {
+	case sc.notify <- struct{}{}:
+	default:
+	}
+	select {
+	case err := <-f.done:
+		return err
+	case <-sc.closed:
+		return ErrClientDisconnected
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (sc *scheduler) push(ctx context.Context, q *channelQueue, f *queuedFrame) error {
+	for {
+		sc.mu.Lock()
+		if len(q.frames) < q.Capacity {
+			q.frames = append(q.frames, f)
+			sc.mu.Unlock()
+			return nil
+		}
+		if q.DropOldest {
+			q.frames[0].done <- ErrFrameDropped
+			q.frames = append(q.frames[1:], f)
+			sc.mu.Unlock()
+			return nil
+		}
+		sc.mu.Unlock()
+		select {
+		case <-q.space:
+		case <-sc.closed:
+			return ErrClientDisconnected
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// next takes a frame by the smooth weighted round-robin of the non-empty queues.
+func (sc *scheduler) next() *queuedFrame {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	var (
+		best  *channelQueue
+		total int
+	)
+	for _, q := range sc.queues {
+		if len(q.frames) == 0 {
+			continue
+		}
+		q.current += q.Weight
+		total += q.Weight
+		if best == nil || q.current > best.current {
+			best = q
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	best.current -= total
+	f := best.frames[0]
+	best.frames[0] = nil
+	best.frames = best.frames[1:]
+	select {
+	case best.space <- struct{}{}:
+	default:
+	}
+	return f
+}
+
+func (sc *scheduler) run() {
+	for {
+		select {
+		case <-sc.closed:
+			return
+		case <-sc.notify:
+		}
+		for f := sc.next(); f != nil; f = sc.next() {
+			if err := f.ctx.Err(); err != nil {
+				f.done <- err
+				continue
+			}
+			if expired(f.ctx) {
+				f.done <- ErrMessageExpired
+				continue
+			}
+			f.done <- sc.write(f.ctx, f.data)
+		}
+	}
+}
+
+func (sc *scheduler) close() {
+	close(sc.closed)
+}
@@ -2,9 +2,12 @@ package core
 
 import (
 	"context"
+	"log/slog"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/cro4k/raindrop/envelope"
 )
 
 type (
@@ -22,11 +25,25 @@ type (
 type clientConn struct {
 	Conn
 
+	session      *Session
+	interceptors []Interceptor
+	handlers     map[string]Handler
+	calls        *calls
+	// scheduler writes the frames by their channels, the frames are written directly if it is nil.
+	scheduler *scheduler
+
 	timeout time.Duration
 
 	once sync.Once
 
 	ping chan struct{}
+	// opened is closed when the session observers and the connected hook are called, the writes wait for it
+	// except theirs.
+	opened chan struct{}
+	// closed is closed when the connection is closed.
+	closed chan struct{}
+	// turns queues the writes while the session is held.
+	turns turns
 
 	onClientConnected    func(ctx context.Context)
 	onClientMessage      func(ctx context.Context, data []byte)
@@ -37,10 +54,16 @@ type clientConn struct {
 
 func (cc *clientConn) onceClose(ctx context.Context) (err error) {
 	cc.once.Do(func() {
+		close(cc.closed)
 		cc.setAlive(false)
 		if cc.onClientDisconnected != nil {
 			cc.onClientDisconnected(ctx)
 		}
+		sessionClosed(ctx, cc.interceptors, cc.session)
+		cc.calls.cancel(cc.session)
+		if cc.scheduler != nil {
+			cc.scheduler.close()
+		}
 		err = cc.Conn.Close()
 	})
 	<-cc.ping
@@ -67,7 +90,10 @@ func (cc *clientConn) receive(ctx context.Context) {
 	defer cc.onceClose(ctx)
 	defer close(cc.ping)
 
-	cc.onClientConnected(ctx)
+	opening := context.WithValue(ctx, openingKey{}, cc)
+	sessionOpened(opening, cc.interceptors, cc.session)
+	cc.onClientConnected(opening)
+	close(cc.opened)
 	cc.setAlive(true)
 	for {
 		select {
@@ -80,15 +106,109 @@ func (cc *clientConn) receive(ctx context.Context) {
 			return
 		}
 		cc.ping <- struct{}{}
+		data, err = inbound(ctx, cc.interceptors, cc.session, data)
+		if err != nil {
+			slog.ErrorContext(ctx, "intercept inbound frame failed", slog.String("id", cc.session.ID),
+				slog.String("error", err.Error()))
+			continue
+		}
+		if data == nil || cc.dispatch(ctx, data) {
+			continue
+		}
 		if cc.onClientMessage != nil {
 			cc.onClientMessage(ctx, data)
 		}
 	}
 }
 
+// dispatch handles the requests and the responses of the calls, it reports false if the data is not one of them.
+func (cc *clientConn) dispatch(ctx context.Context, data []byte) bool {
+	e, _, err := envelope.Decode(data)
+	if err != nil {
+		return false
+	}
+	switch e.GetType() {
+	case envelope.TypeResponse:
+		return cc.calls.resolve(cc.session, e)
+	case envelope.TypeRequest:
+		if e.Header(envelope.HeaderMethod) == "" {
+			return false
+		}
+		go handle(ctx, cc.handlers, cc.session, e)
+		return true
+	}
+	return false
+}
+
+type openingKey struct{}
+
+// write writes the data to the client through the outbound interceptors. The data written by the session
+// observers and the connected hook when the session is opened, e.g. the replayed messages, precedes the others,
+// so does the data written by the holder of the session.
+func (cc *clientConn) write(ctx context.Context, data []byte) error {
+	if ctx.Value(openingKey{}) != cc {
+		select {
+		case <-cc.opened:
+		case <-cc.closed:
+			return ErrClientDisconnected
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if ctx.Value(holdKey{}) != cc {
+		queued, err := cc.turns.queue(ctx)
+		if err != nil {
+			return err
+		}
+		if queued {
+			defer cc.turns.release()
+		}
+	}
+	data, err := outbound(ctx, cc.interceptors, cc.session, data)
+	if err != nil || data == nil {
+		return err
+	}
+	return cc.send(ctx, data)
+}
+
+// send writes the frame to the connection, by the scheduler if there are channels.
+func (cc *clientConn) send(ctx context.Context, data []byte) error {
+	if cc.scheduler != nil {
+		return cc.scheduler.send(ctx, data)
+	}
+	return cc.Write(ctx, data)
+}
+
+// hold takes the turn of the session, the writes by the returned context are not queued.
+func (cc *clientConn) hold(ctx context.Context) (context.Context, func()) {
+	if err := cc.turns.acquire(ctx); err != nil {
+		return ctx, func() {}
+	}
+	var once sync.Once
+	return context.WithValue(ctx, holdKey{}, cc), func() {
+		once.Do(cc.turns.release)
+	}
+}
+
+// abort closes the connection whose session is never opened, e.g. it is not registered, so that the writes
+// waiting for it fail.
+func (cc *clientConn) abort() {
+	cc.once.Do(func() {
+		close(cc.closed)
+		close(cc.ping)
+		if err := cc.Conn.Close(); err != nil {
+			slog.Error("close client conn failed", slog.String("id", cc.session.ID),
+				slog.String("error", err.Error()))
+		}
+	})
+}
+
 func (cc *clientConn) Run(ctx context.Context) {
 	defer cc.onceClose(ctx)
 
+	if cc.scheduler != nil {
+		go cc.scheduler.run()
+	}
 	go cc.receive(ctx)
 	for {
 		select {
@@ -104,11 +224,18 @@ func (cc *clientConn) Run(ctx context.Context) {
 	}
 }
 
-func newClientConn(id string, conn Conn, opt *options, cb Writer) *clientConn {
-	return &clientConn{
-		Conn:    conn,
-		timeout: opt.clientTimeout,
-		ping:    make(chan struct{}),
+func newClientConn(session *Session, conn Conn, opt *options, cb Writer, calls *calls) *clientConn {
+	id := session.ID
+	cc := &clientConn{
+		Conn:         conn,
+		session:      session,
+		interceptors: opt.interceptors,
+		handlers:     opt.handlers,
+		calls:        calls,
+		timeout:      opt.clientTimeout,
+		ping:         make(chan struct{}),
+		opened:       make(chan struct{}),
+		closed:       make(chan struct{}),
 		onClientConnected: func(ctx context.Context) {
 			if opt.onClientConnected != nil {
 				opt.onClientConnected(ctx, id, cb)
@@ -125,4 +252,11 @@ func newClientConn(id string, conn Conn, opt *options, cb Writer) *clientConn {
 			}
 		},
 	}
+	if len(opt.channels) > 0 {
+		cc.scheduler = newScheduler(opt.channels, conn.Write)
+	}
+	session.write = cc.write
+	session.frame = cc.send
+	session.hold = cc.hold
+	return cc
 }
@@ -4,4 +4,8 @@ import "errors"
 
 var (
 	ErrClientConnectionNotFound = errors.New("client connection not found")
+	ErrClientDisconnected       = errors.New("client disconnected")
+	ErrCallNotSupported         = errors.New("call is not supported")
+	ErrMethodNotFound           = errors.New("method not found")
+	ErrTopicsNotSupported       = errors.New("topics are not supported")
 )
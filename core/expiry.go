@@ -0,0 +1,31 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrMessageExpired = errors.New("message is expired")
+
+type expiryKey struct{}
+
+// WithExpiry sets the expiry of the frames written with the context, the frames are not written after it, and
+// it is sent with the frames to the other nodes.
+func WithExpiry(ctx context.Context, expiry time.Time) context.Context {
+	if expiry.IsZero() {
+		return ctx
+	}
+	return context.WithValue(ctx, expiryKey{}, expiry)
+}
+
+// ExpiryFromContext returns the expiry of the context, it is zero if the frames do not expire.
+func ExpiryFromContext(ctx context.Context) time.Time {
+	expiry, _ := ctx.Value(expiryKey{}).(time.Time)
+	return expiry
+}
+
+func expired(ctx context.Context) bool {
+	expiry := ExpiryFromContext(ctx)
+	return !expiry.IsZero() && !time.Now().Before(expiry)
+}
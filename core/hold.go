@@ -0,0 +1,82 @@
+package core
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+type holdKey struct{}
+
+// turns queues the writes of a session while it is held, see Session.Hold. The writes are not queued when the
+// session is not held.
+type turns struct {
+	mu      sync.Mutex
+	held    bool
+	waiting []chan struct{}
+}
+
+// acquire takes the turn, it waits for the former turns if the session is held.
+func (t *turns) acquire(ctx context.Context) error {
+	t.mu.Lock()
+	if !t.held {
+		t.held = true
+		t.mu.Unlock()
+		return nil
+	}
+	return t.wait(ctx)
+}
+
+// queue takes the turn if the session is held, it reports whether the turn is taken, which must be released.
+func (t *turns) queue(ctx context.Context) (bool, error) {
+	t.mu.Lock()
+	if !t.held {
+		t.mu.Unlock()
+		return false, nil
+	}
+	if err := t.wait(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// wait waits for the turn, it is called with the lock held.
+func (t *turns) wait(ctx context.Context) error {
+	turn := make(chan struct{})
+	t.waiting = append(t.waiting, turn)
+	t.mu.Unlock()
+	select {
+	case <-turn:
+		return nil
+	case <-ctx.Done():
+	}
+	t.mu.Lock()
+	if i := slices.Index(t.waiting, turn); i >= 0 {
+		t.waiting = slices.Delete(t.waiting, i, i+1)
+		t.mu.Unlock()
+		return ctx.Err()
+	}
+	t.mu.Unlock()
+	// the turn has been given meanwhile, it is passed on
+	t.release()
+	return ctx.Err()
+}
+
+// release gives the turn to the first waiting one, the session is not held any more if there is none.
+func (t *turns) release() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.waiting) == 0 {
+		t.held = false
+		return
+	}
+	close(t.waiting[0])
+	t.waiting = t.waiting[1:]
+}
+
+// Hold queues the writes to the session until release is called, except the ones by the context it returns, e.g.
+// the backlog of the client which should precede the other messages. The queued writes are written in order after
+// release. If the session is held by another one, Hold waits until it is released.
+func (s *Session) Hold(ctx context.Context) (context.Context, func()) {
+	return s.hold(ctx)
+}
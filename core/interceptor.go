@@ -0,0 +1,97 @@
+package core
+
+import "context"
+
+// Interceptor intercepts the frames of the sessions held by the server.
+type Interceptor interface {
+	// Outbound is called before the data is written to the session.
+	Outbound(ctx context.Context, session *Session, data []byte) ([]byte, error)
+	// Inbound is called when the data is read from the session, a nil result drops the frame.
+	Inbound(ctx context.Context, session *Session, data []byte) ([]byte, error)
+}
+
+// SessionObserver is implemented by the interceptors which observe the lifecycle of the sessions.
+// SessionOpened is called before the connected hook, and SessionClosed is called after the disconnected hook.
+// The other writes to the session wait until SessionOpened and the connected hook return, except the ones of
+// themselves by the context they are given.
+type SessionObserver interface {
+	SessionOpened(ctx context.Context, s *Session)
+	SessionClosed(ctx context.Context, s *Session)
+}
+
+// OfflineWriter is implemented by the interceptors which take the data written to the clients which are not
+// connected to any node, e.g. to deliver it when they connect. It reports whether the data is taken, the first
+// interceptor which takes the data stops the others.
+type OfflineWriter interface {
+	WriteOffline(ctx context.Context, to string, data []byte) (bool, error)
+}
+
+// WithInterceptors adds the interceptors, the outbound frames pass them in order, and the inbound frames
+// pass them in reverse order.
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(o *options) {
+		o.interceptors = append(o.interceptors, interceptors...)
+	}
+}
+
+type rewriteKey struct{}
+
+// Rewrite marks the context of the frames which are written again, e.g. the retries of the unacknowledged
+// messages, so that the interceptors do not stamp or store them again.
+func Rewrite(ctx context.Context) context.Context {
+	return context.WithValue(ctx, rewriteKey{}, true)
+}
+
+// IsRewrite reports whether the frame is written again, see Rewrite.
+func IsRewrite(ctx context.Context) bool {
+	return ctx.Value(rewriteKey{}) != nil
+}
+
+func outbound(ctx context.Context, interceptors []Interceptor, session *Session, data []byte) ([]byte, error) {
+	var err error
+	for _, interceptor := range interceptors {
+		data, err = interceptor.Outbound(ctx, session, data)
+		if err != nil || data == nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func inbound(ctx context.Context, interceptors []Interceptor, session *Session, data []byte) ([]byte, error) {
+	var err error
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		data, err = interceptors[i].Inbound(ctx, session, data)
+		if err != nil || data == nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func writeOffline(ctx context.Context, interceptors []Interceptor, to string, data []byte) (bool, error) {
+	for _, interceptor := range interceptors {
+		if w, ok := interceptor.(OfflineWriter); ok {
+			if taken, err := w.WriteOffline(ctx, to, data); err != nil || taken {
+				return taken, err
+			}
+		}
+	}
+	return false, nil
+}
+
+func sessionOpened(ctx context.Context, interceptors []Interceptor, session *Session) {
+	for _, interceptor := range interceptors {
+		if o, ok := interceptor.(SessionObserver); ok {
+			o.SessionOpened(ctx, session)
+		}
+	}
+}
+
+func sessionClosed(ctx context.Context, interceptors []Interceptor, session *Session) {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		if o, ok := interceptors[i].(SessionObserver); ok {
+			o.SessionClosed(ctx, session)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package core
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/cro4k/raindrop/envelope"
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultCallTimeout = 30 * time.Second
+)
+
+type (
+	// Handler handles a request of a client, the returned payload is answered in a response,
+	// and the error is answered by the envelope.HeaderError header.
+	Handler func(ctx context.Context, id string, payload []byte) ([]byte, error)
+
+	// Caller is implemented by the writers which can call a client and wait for its reply.
+	Caller interface {
+		Call(ctx context.Context, to string, payload []byte) ([]byte, error)
+	}
+)
+
+// CallError is the error answered by the other side of a call.
+type CallError struct {
+	Message string
+}
+
+func (e *CallError) Error() string {
+	return e.Message
+}
+
+// WithHandler registers a handler of the requests whose envelope.HeaderMethod is the method.
+// The requests are handled concurrently, and never reach the client message hook.
+func WithHandler(method string, h Handler) Option {
+	return func(o *options) {
+		if o.handlers == nil {
+			o.handlers = make(map[string]Handler)
+		}
+		o.handlers[method] = h
+	}
+}
+
+// WithCallTimeout sets the timeout of Server.Call when the context has no deadline.
+func WithCallTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.callTimeout = timeout
+	}
+}
+
+type pendingCall struct {
+	session *Session
+	reply   chan *envelope.Envelope
+}
+
+// calls correlates the responses of the clients with the pending calls.
+type calls struct {
+	pending sync.Map
+}
+
+// Call sends the payload to the client in a request, and waits for the payload of its response.
+// The call fails with ErrClientDisconnected if the client is disconnected before it answers.
+func (s *Server) Call(ctx context.Context, to string, payload []byte) ([]byte, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.callTimeout)
+		defer cancel()
+	}
+	cc, ok := s.clients.Load(to)
+	if ok {
+		return s.calls.call(ctx, cc.(*clientConn).session, payload)
+	}
+
+	if s.registryService == nil {
+		return nil, ErrClientConnectionNotFound
+	}
+
+	w, err := s.registryService.Discover(ctx, to)
+	if err != nil {
+		return nil, err
+	}
+	c, ok := w.(Caller)
+	if !ok {
+		return nil, ErrCallNotSupported
+	}
+	return c.Call(ctx, to, payload)
+}
+
+func (c *calls) call(ctx context.Context, session *Session, payload []byte) ([]byte, error) {
+	req := envelope.New(envelope.TypeRequest, payload)
+	pc := &pendingCall{session: session, reply: make(chan *envelope.Envelope, 1)}
+	c.pending.Store(req.GetId(), pc)
+	defer c.pending.Delete(req.GetId())
+
+	data, err := envelope.Encode(req, envelope.FormatBinary)
+	if err != nil {
+		return nil, err
+	}
+	if err := session.Write(ctx, data); err != nil {
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res, ok := <-pc.reply:
+		if !ok {
+			return nil, ErrClientDisconnected
+		}
+		if msg := res.Header(envelope.HeaderError); msg != "" {
+			return nil, &CallError{Message: msg}
+		}
+		return res.GetPayload(), nil
+	}
+}
+
+// resolve delivers the response to its pending call, it reports false if there is no such call.
+func (c *calls) resolve(session *Session, res *envelope.Envelope) bool {
+	val, ok := c.pending.Load(res.GetCorrelationId())
+	if !ok || val.(*pendingCall).session != session {
+		return false
+	}
+	pc := val.(*pendingCall)
+	if c.pending.CompareAndDelete(res.GetCorrelationId(), pc) {
+		pc.reply <- res
+	}
+	return true
+}
+
+// cancel fails the pending calls of the closed session.
+func (c *calls) cancel(session *Session) {
+	c.pending.Range(func(key, val any) bool {
+		pc := val.(*pendingCall)
+		if pc.session == session && c.pending.CompareAndDelete(key, pc) {
+			close(pc.reply)
+		}
+		return true
+	})
+}
+
+// handle answers the request of the client by the handler of its method.
+func handle(ctx context.Context, handlers map[string]Handler, session *Session, req *envelope.Envelope) {
+	res := &envelope.Envelope{
+		Type:          envelope.TypeResponse,
+		Id:            uuid.NewString(),
+		CorrelationId: req.GetId(),
+		Timestamp:     time.Now().UnixMilli(),
+	}
+	h, ok := handlers[req.Header(envelope.HeaderMethod)]
+	if !ok {
+		res.SetHeader(envelope.HeaderError, ErrMethodNotFound.Error())
+	} else if payload, err := h(ctx, session.ID, req.GetPayload()); err != nil {
+		res.SetHeader(envelope.HeaderError, err.Error())
+	} else {
+		res.Payload = payload
+	}
+	data, err := envelope.Encode(res, envelope.FormatBinary)
+	if err == nil {
+		err = session.Write(ctx, data)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "write response failed", slog.String("id", session.ID),
+			slog.String("error", err.Error()))
+	}
+}
@@ -3,9 +3,13 @@ package core
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
 	"sync"
 	"time"
+
+	"github.com/cro4k/raindrop/envelope"
+	"golang.org/x/sync/errgroup"
 )
 
 const (
@@ -17,14 +21,28 @@ type Listener interface {
 	Close() error
 }
 
+// Transport is implemented by the listeners which name the transport of their sessions, e.g. "websocket".
+// A connection can also implement it to override the transport of the listener.
+type Transport interface {
+	Transport() string
+}
+
+func transportOf(l Listener) string {
+	if t, ok := l.(Transport); ok {
+		return t.Transport()
+	}
+	return fmt.Sprintf("%T", l)
+}
+
 type Writer interface {
 	WriteTo(ctx context.Context, to string, data []byte) error
 }
 
 type Server struct {
-	listener Listener
+	listeners []Listener
 
 	clients sync.Map
+	calls   calls
 
 	innerCtx context.Context
 	cancel   context.CancelFunc
@@ -37,9 +55,15 @@ type options struct {
 	onClientMessage      func(ctx context.Context, id string, data []byte, cb Writer)
 	onClientDisconnected func(ctx context.Context, id string, cb Writer)
 	clientTimeout        time.Duration
+	callTimeout          time.Duration
+	handlers             map[string]Handler
 
 	serverIdentity  any
 	registryService RegistryService
+
+	listeners    []Listener
+	interceptors []Interceptor
+	channels     []Channel
 }
 
 type Option func(*options)
@@ -75,27 +99,70 @@ func WithRegistryService(identity any, service RegistryService) Option {
 	}
 }
 
+// WithListeners adds the listeners to the server, all the listeners share the sessions, the registry and the hooks.
+func WithListeners(listeners ...Listener) Option {
+	return func(o *options) {
+		o.listeners = append(o.listeners, listeners...)
+	}
+}
+
 func applyOptions(opts ...Option) *options {
-	opt := &options{clientTimeout: DefaultClientConnTimeout}
+	opt := &options{clientTimeout: DefaultClientConnTimeout, callTimeout: DefaultCallTimeout}
 	for _, o := range opts {
 		o(opt)
 	}
 	return opt
 }
 
+// NewServer creates a server, the listener can be nil if the listeners are set by WithListeners.
 func NewServer(listener Listener, opts ...Option) *Server {
+	opt := applyOptions(opts...)
+	var listeners []Listener
+	if listener != nil {
+		listeners = append(listeners, listener)
+	}
 	return &Server{
-		listener: listener,
-		options:  applyOptions(opts...),
+		listeners: append(listeners, opt.listeners...),
+		options:   opt,
+	}
+}
+
+// Session returns the session of the client connected to this server.
+func (s *Server) Session(id string) (*Session, bool) {
+	cc, ok := s.clients.Load(id)
+	if !ok {
+		return nil, false
 	}
+	return cc.(*clientConn).session, true
 }
 
+// WriteTo writes the data to the client connected to any node. If the client is not connected, the data is
+// given to the interceptors implementing OfflineWriter, and ErrClientConnectionNotFound is returned if none
+// takes it. ErrMessageExpired is returned if the expiry of the context is passed.
 func (s *Server) WriteTo(ctx context.Context, to string, data []byte) error {
+	if expired(ctx) {
+		return ErrMessageExpired
+	}
 	cc, ok := s.clients.Load(to)
 	if ok {
-		return cc.(*clientConn).Write(ctx, data)
+		return cc.(*clientConn).write(ctx, data)
 	}
 
+	err := s.writeRemote(ctx, to, data)
+	if !errors.Is(err, ErrClientConnectionNotFound) {
+		return err
+	}
+	taken, offlineErr := writeOffline(ctx, s.interceptors, to, data)
+	if offlineErr != nil {
+		return offlineErr
+	}
+	if taken {
+		return nil
+	}
+	return err
+}
+
+func (s *Server) writeRemote(ctx context.Context, to string, data []byte) error {
 	if s.registryService == nil {
 		return ErrClientConnectionNotFound
 	}
@@ -104,25 +171,84 @@ func (s *Server) WriteTo(ctx context.Context, to string, data []byte) error {
 	if err != nil {
 		return err
 	}
+	if cw, ok := w.(ChannelWriter); ok {
+		if channel := ChannelFromContext(ctx); channel != "" {
+			return cw.WriteToChannel(ctx, to, channel, data)
+		}
+	}
+	return w.WriteTo(ctx, to, data)
+}
+
+// WriteEnvelope writes the envelope to the client in binary format.
+func WriteEnvelope(ctx context.Context, w Writer, to string, e *envelope.Envelope) error {
+	data, err := envelope.Encode(e, envelope.FormatBinary)
+	if err != nil {
+		return err
+	}
 	return w.WriteTo(ctx, to, data)
 }
 
 func (s *Server) Start(ctx context.Context) error {
+	if len(s.listeners) == 0 {
+		return errors.New("no listener")
+	}
 	s.innerCtx, s.cancel = context.WithCancel(ctx)
-	return s.listener.Serve(ctx, func(id string, conn Conn) error {
-		select {
-		case <-s.innerCtx.Done():
-			return s.innerCtx.Err()
-		default:
+	var (
+		once    sync.Once
+		failure error
+	)
+	group, groupCtx := errgroup.WithContext(s.innerCtx)
+	for i, listener := range s.listeners {
+		transport := transportOf(listener)
+		group.Go(func() error {
+			err := listener.Serve(groupCtx, func(id string, conn Conn) error {
+				select {
+				case <-s.innerCtx.Done():
+					return s.innerCtx.Err()
+				default:
+				}
+				session := newSession(id, transport, conn)
+				cc := newClientConn(session, conn, s.options, s, &s.calls)
+				go s.serve(withSession(ctx, session), id, cc)
+				return nil
+			})
+			if err != nil {
+				// the first failed listener stops the server, so that Start returns its error rather than the
+				// errors of the closed listeners.
+				once.Do(func() {
+					failure = err
+					s.cancel()
+					s.closeListeners(i)
+				})
+			}
+			return err
+		})
+	}
+	err := group.Wait()
+	if failure != nil {
+		return failure
+	}
+	return err
+}
+
+// closeListeners closes the listeners except the one at the index.
+func (s *Server) closeListeners(except int) {
+	for i, listener := range s.listeners {
+		if i == except {
+			continue
 		}
-		cc := newClientConn(id, conn, s.options, s)
-		go s.serve(ctx, id, cc)
-		return nil
-	})
+		if err := listener.Close(); err != nil {
+			slog.Error("close listener failed", slog.String("transport", transportOf(listener)),
+				slog.String("error", err.Error()))
+		}
+	}
 }
 
 func (s *Server) Stop(ctx context.Context) error {
-	err := s.listener.Close()
+	var err error
+	for _, listener := range s.listeners {
+		err = errors.Join(err, listener.Close())
+	}
 	if s.cancel == nil {
 		return errors.Join(err, errors.New("the server has not been started"))
 	}
@@ -135,12 +261,13 @@ func (s *Server) serve(ctx context.Context, id string, cc *clientConn) {
 	if loaded {
 		_ = old.(*clientConn).Close()
 	}
-	defer s.clients.Delete(id)
+	defer s.clients.CompareAndDelete(id, cc)
 	if s.registryService != nil {
 		defer s.registryService.Deregister(ctx, id)
 		if err := s.registryService.Register(ctx, id, s.serverIdentity, cc); err != nil {
 			slog.ErrorContext(ctx, "register client conn failed", slog.String("id", id),
 				slog.String("error", err.Error()))
+			cc.abort()
 			return
 		}
 	}
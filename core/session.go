@@ -0,0 +1,76 @@
+package core
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Session describes a client connection held by the server.
+type Session struct {
+	ID          string
+	Transport   string
+	ConnectedAt time.Time
+
+	// Subprotocol and Params are the negotiated subprotocol and the parameters (e.g. the query string)
+	// of the handshake, they are set if the connection implements Handshake.
+	Subprotocol string
+	Params      url.Values
+
+	values sync.Map
+	write  func(ctx context.Context, data []byte) error
+	frame  func(ctx context.Context, data []byte) error
+	hold   func(ctx context.Context) (context.Context, func())
+}
+
+// Handshake is implemented by the connections which carry the information of their handshake.
+type Handshake interface {
+	Subprotocol() string
+	Params() url.Values
+}
+
+func newSession(id, transport string, conn Conn) *Session {
+	s := &Session{ID: id, Transport: transport, ConnectedAt: time.Now()}
+	if t, ok := conn.(Transport); ok {
+		s.Transport = t.Transport()
+	}
+	if h, ok := conn.(Handshake); ok {
+		s.Subprotocol = h.Subprotocol()
+		s.Params = h.Params()
+	}
+	return s
+}
+
+// Write writes the data to the client through all the outbound interceptors.
+func (s *Session) Write(ctx context.Context, data []byte) error {
+	return s.write(ctx, data)
+}
+
+// WriteFrame writes the data to the connection directly, none of the interceptors is called. It is meant for the
+// interceptors which write several frames in place of one, e.g. the fragments of a large frame.
+func (s *Session) WriteFrame(ctx context.Context, data []byte) error {
+	return s.frame(ctx, data)
+}
+
+// Value returns the value of the key stored in the session.
+func (s *Session) Value(key any) (any, bool) {
+	return s.values.Load(key)
+}
+
+// SetValue stores a value in the session, it lives as long as the session.
+func (s *Session) SetValue(key, val any) {
+	s.values.Store(key, val)
+}
+
+type sessionKey struct{}
+
+func withSession(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, s)
+}
+
+// SessionFromContext returns the session in the context of the client hooks.
+func SessionFromContext(ctx context.Context) (*Session, bool) {
+	s, ok := ctx.Value(sessionKey{}).(*Session)
+	return s, ok
+}
@@ -0,0 +1,9 @@
+package core
+
+import "context"
+
+// TopicWriter is implemented by the writers which write to the clients subscribing to a topic, e.g. the topic
+// brokers of the nodes.
+type TopicWriter interface {
+	WriteToTopic(ctx context.Context, topic string, data []byte) error
+}
@@ -0,0 +1,48 @@
+package raindrop
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// DeadLetter is a message which cannot be resolved or delivered.
+type DeadLetter struct {
+	// ID is assigned by the sink.
+	ID      string     `json:"id"`
+	Message RawMessage `json:"message"`
+	Reason  string     `json:"reason"`
+	// Destinations are the failed destinations, it is empty if the message cannot be resolved.
+	Destinations []string  `json:"destinations,omitempty"`
+	Attempts     int       `json:"attempts"`
+	FailedAt     time.Time `json:"failed_at"`
+}
+
+// DeadLetterSink keeps the dead letters, e.g. to inspect and replay them later.
+type DeadLetterSink interface {
+	Put(ctx context.Context, dl *DeadLetter) error
+}
+
+// WithDeadLetterSink sets the sink of the messages whose resolution or delivery fails.
+func WithDeadLetterSink(sink DeadLetterSink) OptionFunc {
+	return func(r *Raindrop) {
+		r.deadLetters = sink
+	}
+}
+
+func (r *Raindrop) deadLetter(ctx context.Context, m *RawMessage, reason error, destinations []string, attempts int) {
+	if r.deadLetters == nil {
+		return
+	}
+	dl := &DeadLetter{
+		Message:      *m,
+		Reason:       reason.Error(),
+		Destinations: destinations,
+		Attempts:     attempts,
+		FailedAt:     time.Now(),
+	}
+	if err := r.deadLetters.Put(context.WithoutCancel(ctx), dl); err != nil {
+		slog.ErrorContext(ctx, "put dead letter failed", slog.String("message", m.ID),
+			slog.String("reason", dl.Reason), slog.String("error", err.Error()))
+	}
+}
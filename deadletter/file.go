@@ -0,0 +1,112 @@
+package deadletter
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/cro4k/raindrop"
+	"github.com/google/uuid"
+)
+
+// FileStore keeps the dead letters in a local file, one JSON object per line. The file is opened for each
+// dead letter, so that it can be rotated or rewritten by another process.
+type FileStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+func (s *FileStore) Put(ctx context.Context, dl *raindrop.DeadLetter) error {
+	if dl.ID == "" {
+		dl.ID = uuid.NewString()
+	}
+	val, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(val, '\n'))
+	return errors.Join(err, f.Close())
+}
+
+func (s *FileStore) List(ctx context.Context, limit int) ([]*raindrop.DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+// Delete rewrites the file without the dead letters.
+func (s *FileStore) Delete(ctx context.Context, ids ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list, err := s.read()
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	for _, dl := range list {
+		if slices.Contains(ids, dl.ID) {
+			continue
+		}
+		val, err := json.Marshal(dl)
+		if err != nil {
+			return errors.Join(err, tmp.Close())
+		}
+		_, _ = w.Write(append(val, '\n'))
+	}
+	if err := errors.Join(w.Flush(), tmp.Close()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func (s *FileStore) read() ([]*raindrop.DeadLetter, error) {
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var list []*raindrop.DeadLetter
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		dl := new(raindrop.DeadLetter)
+		if err := json.Unmarshal(scanner.Bytes(), dl); err != nil {
+			return nil, err
+		}
+		list = append(list, dl)
+	}
+	return list, scanner.Err()
+}
@@ -0,0 +1,94 @@
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/cro4k/raindrop"
+	"github.com/redis/go-redis/v9"
+)
+
+const letterField = "letter"
+
+// RedisStore keeps the dead letters in a redis stream, the ids of the dead letters are the ids of the entries.
+type RedisStore struct {
+	client redis.UniversalClient
+	key    string
+	maxLen int64
+}
+
+type RedisStoreOption func(*RedisStore)
+
+func WithKey(key string) RedisStoreOption {
+	return func(s *RedisStore) {
+		s.key = key
+	}
+}
+
+// WithMaxLen sets the approximate max length of the stream, the oldest dead letters are trimmed.
+func WithMaxLen(maxLen int64) RedisStoreOption {
+	return func(s *RedisStore) {
+		s.maxLen = maxLen
+	}
+}
+
+func NewRedisStore(client redis.UniversalClient, options ...RedisStoreOption) *RedisStore {
+	s := &RedisStore{
+		client: client,
+		key:    "RAINDROP_DEAD_LETTERS",
+		maxLen: 100000,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+func (s *RedisStore) Put(ctx context.Context, dl *raindrop.DeadLetter) error {
+	val, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+	id, err := s.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.key,
+		MaxLen: s.maxLen,
+		Approx: true,
+		Values: []any{letterField, val},
+	}).Result()
+	if err != nil {
+		return err
+	}
+	dl.ID = id
+	return nil
+}
+
+func (s *RedisStore) List(ctx context.Context, limit int) ([]*raindrop.DeadLetter, error) {
+	var cmd *redis.XMessageSliceCmd
+	if limit > 0 {
+		cmd = s.client.XRangeN(ctx, s.key, "-", "+", int64(limit))
+	} else {
+		cmd = s.client.XRange(ctx, s.key, "-", "+")
+	}
+	entries, err := cmd.Result()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*raindrop.DeadLetter, 0, len(entries))
+	for _, entry := range entries {
+		val, _ := entry.Values[letterField].(string)
+		dl := new(raindrop.DeadLetter)
+		if err := json.Unmarshal([]byte(val), dl); err != nil {
+			return nil, err
+		}
+		dl.ID = entry.ID
+		list = append(list, dl)
+	}
+	return list, nil
+}
+
+func (s *RedisStore) Delete(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return s.client.XDel(ctx, s.key, ids...).Err()
+}
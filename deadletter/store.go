@@ -0,0 +1,15 @@
+package deadletter
+
+import (
+	"context"
+
+	"github.com/cro4k/raindrop"
+)
+
+// Store is a raindrop.DeadLetterSink whose dead letters can be inspected and removed.
+type Store interface {
+	raindrop.DeadLetterSink
+	// List returns at most limit dead letters in the order they are put, all of them if the limit is 0.
+	List(ctx context.Context, limit int) ([]*raindrop.DeadLetter, error)
+	Delete(ctx context.Context, ids ...string) error
+}
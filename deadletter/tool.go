@@ -0,0 +1,137 @@
+package deadletter
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cro4k/raindrop"
+	"github.com/cro4k/raindrop/group"
+)
+
+var ErrUnknownCommand = errors.New("unknown command")
+
+// Tool inspects and replays the dead letters. It is meant to be run by a command of the application, which
+// builds the Raindrop with its own publisher, e.g.
+//
+//	tool := deadletter.NewTool(deadletter.NewRedisStore(redisClient), r, os.Stdout)
+//	if err := tool.Run(ctx, os.Args[1:]); err != nil {
+//		log.Fatal(err)
+//	}
+type Tool struct {
+	store    Store
+	raindrop *raindrop.Raindrop
+	out      io.Writer
+}
+
+func NewTool(store Store, r *raindrop.Raindrop, out io.Writer) *Tool {
+	return &Tool{store: store, raindrop: r, out: out}
+}
+
+// Run runs a command of the arguments:
+//
+//	list [-n limit]            lists the dead letters
+//	replay [-n limit] [id...]  sends the dead letters again by Raindrop.Send, and deletes the sent ones
+//	delete id...               deletes the dead letters
+func (t *Tool) Run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: expect list, replay or delete", ErrUnknownCommand)
+	}
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	flags.SetOutput(t.out)
+	limit := flags.Int("n", 0, "max count of the dead letters, 0 for all")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	switch args[0] {
+	case "list":
+		list, err := t.store.List(ctx, *limit)
+		if err != nil {
+			return err
+		}
+		return t.print(list)
+	case "replay":
+		list, err := t.find(ctx, *limit, flags.Args())
+		if err != nil {
+			return err
+		}
+		n, err := t.Replay(ctx, list)
+		fmt.Fprintf(t.out, "replayed %d of %d dead letters\n", n, len(list))
+		return err
+	case "delete":
+		if flags.NArg() == 0 {
+			return errors.New("no dead letter to delete")
+		}
+		return t.store.Delete(ctx, flags.Args()...)
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownCommand, args[0])
+}
+
+// Replay sends the dead letters again with new timestamps, the sent ones are deleted. It stops at the first error.
+// A dead letter with destinations is only sent to them, so that the recipients which got the message do not get it
+// again. The messages keep their expiries, the expired ones are reported and kept in the store.
+func (t *Tool) Replay(ctx context.Context, list []*raindrop.DeadLetter) (int, error) {
+	n := 0
+	for _, dl := range list {
+		if dl.Message.Expired(time.Now()) {
+			fmt.Fprintf(t.out, "skip %s: expired at %s\n", dl.ID, dl.Message.ExpiresAt.Format(time.RFC3339))
+			continue
+		}
+		m := replayMessage(dl)
+		if err := t.raindrop.SendMessage(ctx, m); err != nil {
+			return n, fmt.Errorf("replay %s: %w", dl.ID, err)
+		}
+		n++
+		if err := t.store.Delete(ctx, dl.ID); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// replayMessage returns the message of the dead letter to replay, which is marked by raindrop.HeaderReplay so that
+// it is not dropped as a duplicate of the message. If the dead letter has destinations, they are the recipients of
+// the message, and its group and topic are dropped.
+func replayMessage(dl *raindrop.DeadLetter) *raindrop.RawMessage {
+	m := dl.Message
+	m.Timestamp = time.Time{}
+	m.Headers = maps.Clone(m.Headers)
+	m.SetHeader(raindrop.HeaderReplay, dl.ID)
+	if len(dl.Destinations) > 0 {
+		m.To = slices.Clone(dl.Destinations)
+		delete(m.Headers, group.HeaderGroup)
+		delete(m.Headers, raindrop.HeaderTopic)
+	}
+	return &m
+}
+
+func (t *Tool) find(ctx context.Context, limit int, ids []string) ([]*raindrop.DeadLetter, error) {
+	if len(ids) == 0 {
+		return t.store.List(ctx, limit)
+	}
+	list, err := t.store.List(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(list, func(dl *raindrop.DeadLetter) bool {
+		return !slices.Contains(ids, dl.ID)
+	}), nil
+}
+
+func (t *Tool) print(list []*raindrop.DeadLetter) error {
+	w := tabwriter.NewWriter(t.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tFAILED AT\tATTEMPTS\tMESSAGE\tSIZE\tDESTINATIONS\tREASON")
+	for _, dl := range list {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%d\t%s\t%s\n", dl.ID, dl.FailedAt.Format(time.RFC3339), dl.Attempts,
+			dl.Message.ID, len(dl.Message.Data), strings.Join(dl.Destinations, ","),
+			strings.ReplaceAll(dl.Reason, "\n", "; "))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,117 @@
+package raindrop
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// claimExtendInterval is how often the claim of a message is extended while the message is delivered.
+const claimExtendInterval = 20 * time.Second
+
+// HeaderReplay is the id of the dead letter which a replayed message is sent for, the replays of a message are
+// deduplicated apart from the message, so that they are not dropped as its duplicates.
+const HeaderReplay = "replay"
+
+// Deduplicator remembers the ids of the messages within a window, e.g. dedupe.MemoryDeduplicator for a single
+// node, or dedupe.RedisDeduplicator for a cluster. An id is claimed when the message is received, and it is
+// committed when the message is delivered or its failed destinations are handed to the retry, offline or
+// dead-letter path, or released when the message is not resolved, so that a redelivery of the message queue is
+// not dropped. The claim is extended every 20 seconds while the message is delivered.
+type Deduplicator interface {
+	// Claim claims the id, and reports false if the id is claimed or committed within the window.
+	Claim(ctx context.Context, id string) (bool, error)
+	// Extend keeps the claimed id, e.g. for a large fan-out.
+	Extend(ctx context.Context, id string) error
+	// Commit remembers the claimed id for the window.
+	Commit(ctx context.Context, id string) error
+	// Release releases the claimed id.
+	Release(ctx context.Context, id string) error
+}
+
+// WithDeduplicator drops the messages whose ids are seen within the window of the deduplicator, e.g. the
+// duplicates of the producer retries or of an at-least-once message queue. The messages without ids are not
+// deduplicated, and the messages are not deduplicated by default.
+//
+// The id of a message is remembered once the message is delivered, or its failed destinations are retried or
+// dead-lettered, a message which is not resolved or published to its topic is delivered again if it is received
+// again.
+func WithDeduplicator(d Deduplicator) OptionFunc {
+	return func(r *Raindrop) {
+		r.dedupe = d
+	}
+}
+
+// Duplicates returns the count of the messages which are dropped since they are duplicates.
+func (r *Raindrop) Duplicates() uint64 {
+	return r.duplicates.Load()
+}
+
+// claim claims the message, it returns the key of the claim, which is empty if the message is not deduplicated,
+// and reports whether the message is a duplicate. The message is delivered if the deduplicator fails.
+func (r *Raindrop) claim(ctx context.Context, m *RawMessage) (string, bool) {
+	if r.dedupe == nil || m.ID == "" {
+		return "", false
+	}
+	key := m.ID
+	if replay := m.Header(HeaderReplay); replay != "" {
+		key += "/" + replay
+	}
+	claimed, err := r.dedupe.Claim(ctx, key)
+	if err != nil {
+		slog.ErrorContext(ctx, "deduplicate message failed", slog.String("message", m.ID),
+			slog.String("error", err.Error()))
+		return "", false
+	}
+	if !claimed {
+		r.duplicates.Add(1)
+		return "", true
+	}
+	return key, false
+}
+
+// extend extends the claim of the key until the returned function is called.
+func (r *Raindrop) extend(ctx context.Context, key string) func() {
+	if key == "" {
+		return func() {}
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(claimExtendInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := r.dedupe.Extend(ctx, key); err != nil {
+				slog.ErrorContext(ctx, "extend deduplicated message failed", slog.String("key", key),
+					slog.String("error", err.Error()))
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// settle commits the claim if the message is delivered, or releases it.
+func (r *Raindrop) settle(ctx context.Context, key string, delivered bool) {
+	if key == "" {
+		return
+	}
+	settle := r.dedupe.Release
+	if delivered {
+		settle = r.dedupe.Commit
+	}
+	if err := settle(context.WithoutCancel(ctx), key); err != nil {
+		slog.ErrorContext(ctx, "settle deduplicated message failed", slog.String("key", key),
+			slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,53 @@
+package dedupe
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+const (
+	DefaultWindow = 10 * time.Minute
+	DefaultSize   = 100000
+)
+
+// MemoryDeduplicator remembers the ids in an LRU of a node, the ids are forgotten after the window, or when the
+// LRU is full.
+type MemoryDeduplicator struct {
+	mu  sync.Mutex
+	lru *expirable.LRU[string, struct{}]
+}
+
+// NewMemoryDeduplicator creates a deduplicator which remembers at most size ids within the window.
+func NewMemoryDeduplicator(size int, window time.Duration) *MemoryDeduplicator {
+	return &MemoryDeduplicator{lru: expirable.NewLRU[string, struct{}](size, nil, window)}
+}
+
+func (d *MemoryDeduplicator) Claim(ctx context.Context, id string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.lru.Get(id); ok {
+		return false, nil
+	}
+	d.lru.Add(id, struct{}{})
+	return true, nil
+}
+
+// Commit keeps the claimed id, which is remembered for the window since it is claimed.
+func (d *MemoryDeduplicator) Commit(ctx context.Context, id string) error {
+	return nil
+}
+
+// Extend keeps the claimed id, which is remembered for the window since it is claimed.
+func (d *MemoryDeduplicator) Extend(ctx context.Context, id string) error {
+	return nil
+}
+
+func (d *MemoryDeduplicator) Release(ctx context.Context, id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lru.Remove(id)
+	return nil
+}
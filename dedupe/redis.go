@@ -0,0 +1,80 @@
+package dedupe
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultClaimTTL is how long a claimed id is kept without being committed, e.g. if the node fails.
+const DefaultClaimTTL = time.Minute
+
+var (
+	extendScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == 'claimed' then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return 0`)
+
+	releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == 'claimed' then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`)
+)
+
+// RedisDeduplicator remembers the ids by the redis keys which expire after the window, so that the duplicates
+// are dropped by any node of a cluster. A claimed id expires after the claim TTL unless it is committed, so that
+// the message is delivered again if the node which claims it fails.
+type RedisDeduplicator struct {
+	client   redis.UniversalClient
+	window   time.Duration
+	claimTTL time.Duration
+	prefix   string
+}
+
+type RedisDeduplicatorOption func(*RedisDeduplicator)
+
+func WithPrefix(prefix string) RedisDeduplicatorOption {
+	return func(d *RedisDeduplicator) {
+		d.prefix = prefix
+	}
+}
+
+// WithClaimTTL sets how long a claimed id is kept without being committed or extended, it is DefaultClaimTTL by
+// default. It should be longer than the 20 seconds by which the claims are extended.
+func WithClaimTTL(ttl time.Duration) RedisDeduplicatorOption {
+	return func(d *RedisDeduplicator) {
+		d.claimTTL = ttl
+	}
+}
+
+func NewRedisDeduplicator(client redis.UniversalClient, window time.Duration, options ...RedisDeduplicatorOption) *RedisDeduplicator {
+	d := &RedisDeduplicator{
+		client:   client,
+		window:   window,
+		claimTTL: DefaultClaimTTL,
+		prefix:   "RAINDROP_DEDUPE:",
+	}
+	for _, option := range options {
+		option(d)
+	}
+	return d
+}
+
+func (d *RedisDeduplicator) Claim(ctx context.Context, id string) (bool, error) {
+	return d.client.SetNX(ctx, d.prefix+id, "claimed", d.claimTTL).Result()
+}
+
+func (d *RedisDeduplicator) Commit(ctx context.Context, id string) error {
+	return d.client.Set(ctx, d.prefix+id, "committed", d.window).Err()
+}
+
+func (d *RedisDeduplicator) Extend(ctx context.Context, id string) error {
+	return extendScript.Run(ctx, d.client, []string{d.prefix + id}, d.claimTTL.Milliseconds()).Err()
+}
+
+func (d *RedisDeduplicator) Release(ctx context.Context, id string) error {
+	return releaseScript.Run(ctx, d.client, []string{d.prefix + id}).Err()
+}
@@ -0,0 +1,205 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/cro4k/raindrop/core"
+	"github.com/cro4k/raindrop/envelope"
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultMaxAttempts    = 5
+	DefaultInitialBackoff = time.Second
+	DefaultMaxBackoff     = 30 * time.Second
+
+	retryTimeout = 10 * time.Second
+)
+
+// DeliveryFailed is fired when a message is not acknowledged after all the attempts.
+type DeliveryFailed struct {
+	To       string
+	ID       string
+	Data     []byte
+	Attempts int
+}
+
+// Acknowledger is a core.Interceptor which delivers the messages at least once. Each outbound envelope of
+// envelope.TypeMessage gets an id, and it is written again with backoff until the client answers an
+// envelope.TypeAck whose correlation id is the id of the message. When the attempts run out, DeliveryFailed
+// is fired.
+//
+// The inflight messages are kept in the InflightStore, and they are written again when the recipient connects
+// to any node sharing the store. The Acknowledger should precede the other interceptors except the Sequencer, so
+// that the stored messages are not transcoded yet.
+type Acknowledger struct {
+	store InflightStore
+
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	onFailed       func(ctx context.Context, f *DeliveryFailed)
+
+	mu     sync.Mutex
+	timers map[*core.Session]map[string]*time.Timer
+}
+
+type AckOption func(*Acknowledger)
+
+func WithMaxAttempts(attempts int) AckOption {
+	return func(a *Acknowledger) {
+		a.maxAttempts = attempts
+	}
+}
+
+// WithBackoff sets the backoff of the retries, it doubles for each attempt until the max.
+func WithBackoff(initial, max time.Duration) AckOption {
+	return func(a *Acknowledger) {
+		a.initialBackoff = initial
+		a.maxBackoff = max
+	}
+}
+
+func WithDeliveryFailedHandler(f func(ctx context.Context, failed *DeliveryFailed)) AckOption {
+	return func(a *Acknowledger) {
+		a.onFailed = f
+	}
+}
+
+func NewAcknowledger(store InflightStore, options ...AckOption) *Acknowledger {
+	a := &Acknowledger{
+		store:          store,
+		maxAttempts:    DefaultMaxAttempts,
+		initialBackoff: DefaultInitialBackoff,
+		maxBackoff:     DefaultMaxBackoff,
+		timers:         make(map[*core.Session]map[string]*time.Timer),
+	}
+	for _, option := range options {
+		option(a)
+	}
+	return a
+}
+
+type closedKey struct{}
+
+func (a *Acknowledger) Outbound(ctx context.Context, s *core.Session, data []byte) ([]byte, error) {
+	if core.IsRewrite(ctx) {
+		return data, nil
+	}
+	e, format, err := envelope.Decode(data)
+	if err != nil || e.GetType() != envelope.TypeMessage {
+		return data, nil
+	}
+	if e.GetId() == "" {
+		e.Id = uuid.NewString()
+		if data, err = envelope.Encode(e, format); err != nil {
+			return nil, err
+		}
+	}
+	m := &InflightMessage{ID: e.GetId(), Data: data, Attempts: 1, FirstSentAt: time.Now()}
+	if err := a.store.Put(ctx, s.ID, m); err != nil {
+		return nil, err
+	}
+	a.schedule(s, m.ID, a.backoff(m.Attempts))
+	return data, nil
+}
+
+func (a *Acknowledger) Inbound(ctx context.Context, s *core.Session, data []byte) ([]byte, error) {
+	e, _, err := envelope.Decode(data)
+	if err != nil || e.GetType() != envelope.TypeAck {
+		return data, nil
+	}
+	a.unschedule(s, e.GetCorrelationId())
+	return nil, a.store.Delete(ctx, s.ID, e.GetCorrelationId())
+}
+
+// SessionOpened writes the inflight messages of the recipient again, which may be written by another node.
+func (a *Acknowledger) SessionOpened(ctx context.Context, s *core.Session) {
+	list, err := a.store.List(ctx, s.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "list inflight messages failed", slog.String("id", s.ID),
+			slog.String("error", err.Error()))
+		return
+	}
+	for _, m := range list {
+		a.retry(ctx, s, m.ID)
+	}
+}
+
+// SessionClosed stops the retries of the session, the inflight messages are kept in the store.
+func (a *Acknowledger) SessionClosed(ctx context.Context, s *core.Session) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s.SetValue(closedKey{}, true)
+	for _, timer := range a.timers[s] {
+		timer.Stop()
+	}
+	delete(a.timers, s)
+}
+
+func (a *Acknowledger) retry(ctx context.Context, s *core.Session, id string) {
+	a.unschedule(s, id)
+	m, exhausted, err := a.store.Attempt(ctx, s.ID, id, a.maxAttempts)
+	if errors.Is(err, ErrInflightNotFound) {
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "attempt inflight message failed", slog.String("id", s.ID),
+			slog.String("message", id), slog.String("error", err.Error()))
+		a.schedule(s, id, a.maxBackoff)
+		return
+	}
+	if exhausted {
+		if a.onFailed != nil {
+			a.onFailed(ctx, &DeliveryFailed{To: s.ID, ID: m.ID, Data: m.Data, Attempts: m.Attempts})
+		}
+		return
+	}
+	if err := s.Write(core.Rewrite(ctx), m.Data); err != nil {
+		slog.ErrorContext(ctx, "write inflight message failed", slog.String("id", s.ID),
+			slog.String("message", id), slog.String("error", err.Error()))
+	}
+	a.schedule(s, id, a.backoff(m.Attempts))
+}
+
+func (a *Acknowledger) backoff(attempts int) time.Duration {
+	d := a.initialBackoff
+	for i := 1; i < attempts && d < a.maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, a.maxBackoff)
+}
+
+func (a *Acknowledger) schedule(s *core.Session, id string, delay time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, closed := s.Value(closedKey{}); closed {
+		return
+	}
+	timers, ok := a.timers[s]
+	if !ok {
+		timers = make(map[string]*time.Timer)
+		a.timers[s] = timers
+	}
+	if timer, ok := timers[id]; ok {
+		timer.Stop()
+	}
+	timers[id] = time.AfterFunc(delay, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), retryTimeout)
+		defer cancel()
+		a.retry(ctx, s, id)
+	})
+}
+
+func (a *Acknowledger) unschedule(s *core.Session, id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if timer, ok := a.timers[s][id]; ok {
+		timer.Stop()
+		delete(a.timers[s], id)
+	}
+}
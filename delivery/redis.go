@@ -0,0 +1,334 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisInflightStore keeps the inflight messages of each recipient in a redis hash.
+type RedisInflightStore struct {
+	client redis.UniversalClient
+	prefix string
+	ttl    time.Duration
+}
+
+type RedisInflightStoreOption func(*RedisInflightStore)
+
+func WithInflightPrefix(prefix string) RedisInflightStoreOption {
+	return func(s *RedisInflightStore) {
+		s.prefix = prefix
+	}
+}
+
+// WithInflightTTL sets how long the inflight messages of a recipient are kept after the last write.
+func WithInflightTTL(ttl time.Duration) RedisInflightStoreOption {
+	return func(s *RedisInflightStore) {
+		s.ttl = ttl
+	}
+}
+
+func NewRedisInflightStore(client redis.UniversalClient, options ...RedisInflightStoreOption) *RedisInflightStore {
+	s := &RedisInflightStore{
+		client: client,
+		prefix: "RAINDROP_INFLIGHT:",
+		ttl:    24 * time.Hour,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+func (s *RedisInflightStore) Put(ctx context.Context, to string, m *InflightMessage) error {
+	val, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	key := s.key(to)
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, m.ID, val)
+		pipe.Expire(ctx, key, s.ttl)
+		return nil
+	})
+	return err
+}
+
+func (s *RedisInflightStore) Get(ctx context.Context, to, id string) (*InflightMessage, error) {
+	val, err := s.client.HGet(ctx, s.key(to), id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrInflightNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	m := new(InflightMessage)
+	return m, json.Unmarshal(val, m)
+}
+
+func (s *RedisInflightStore) Delete(ctx context.Context, to, id string) error {
+	return s.client.HDel(ctx, s.key(to), id).Err()
+}
+
+var attemptScript = redis.NewScript(`
+local val = redis.call('HGET', KEYS[1], ARGV[1])
+if not val then
+	return false
+end
+local m = cjson.decode(val)
+if m.attempts >= tonumber(ARGV[2]) then
+	redis.call('HDEL', KEYS[1], ARGV[1])
+	return {val, 1}
+end
+m.attempts = m.attempts + 1
+val = cjson.encode(m)
+redis.call('HSET', KEYS[1], ARGV[1], val)
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return {val, 0}`)
+
+func (s *RedisInflightStore) Attempt(ctx context.Context, to, id string, max int) (*InflightMessage, bool, error) {
+	res, err := attemptScript.Run(ctx, s.client, []string{s.key(to)}, id, max, s.ttl.Milliseconds()).Slice()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, ErrInflightNotFound
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	val, _ := res[0].(string)
+	exhausted, _ := res[1].(int64)
+	m := new(InflightMessage)
+	return m, exhausted == 1, json.Unmarshal([]byte(val), m)
+}
+
+func (s *RedisInflightStore) List(ctx context.Context, to string) ([]*InflightMessage, error) {
+	vals, err := s.client.HGetAll(ctx, s.key(to)).Result()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*InflightMessage, 0, len(vals))
+	for _, val := range vals {
+		m := new(InflightMessage)
+		if err := json.Unmarshal([]byte(val), m); err != nil {
+			return nil, err
+		}
+		list = append(list, m)
+	}
+	sortInflight(list)
+	return list, nil
+}
+
+func (s *RedisInflightStore) key(to string) string {
+	return fmt.Sprintf("%s%s", s.prefix, to)
+}
+
+// RedisSequenceStore allocates the sequences by redis counters, which are kept the TTL after the last message.
+type RedisSequenceStore struct {
+	client redis.UniversalClient
+	prefix string
+	ttl    time.Duration
+}
+
+type RedisSequenceStoreOption func(*RedisSequenceStore)
+
+func WithSequencePrefix(prefix string) RedisSequenceStoreOption {
+	return func(s *RedisSequenceStore) {
+		s.prefix = prefix
+	}
+}
+
+// WithSequenceTTL sets how long the sequences of a stream are kept after the last message, the stream restarts
+// from 1 once they are expired.
+func WithSequenceTTL(ttl time.Duration) RedisSequenceStoreOption {
+	return func(s *RedisSequenceStore) {
+		s.ttl = ttl
+	}
+}
+
+func NewRedisSequenceStore(client redis.UniversalClient, options ...RedisSequenceStoreOption) *RedisSequenceStore {
+	s := &RedisSequenceStore{
+		client: client,
+		prefix: "RAINDROP_SEQUENCE:",
+		ttl:    7 * 24 * time.Hour,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+func (s *RedisSequenceStore) Next(ctx context.Context, to, stream string) (uint64, error) {
+	key := s.key(to, stream)
+	var incr *redis.IntCmd
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, key)
+		pipe.Expire(ctx, key, s.ttl)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return uint64(incr.Val()), nil
+}
+
+// Keep keeps the messages of a stream in a redis sorted set by their sequences, which expires with the sequences.
+func (s *RedisSequenceStore) Keep(ctx context.Context, to, stream string, m *SequencedMessage, max int) error {
+	key := s.key(to, stream) + ":KEPT"
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(m.Seq), Member: m.Data})
+		pipe.ZRemRangeByRank(ctx, key, 0, int64(-max-1))
+		pipe.Expire(ctx, key, s.ttl)
+		return nil
+	})
+	return err
+}
+
+func (s *RedisSequenceStore) Range(ctx context.Context, to, stream string, from, until uint64) ([]*SequencedMessage, error) {
+	vals, err := s.client.ZRangeByScoreWithScores(ctx, s.key(to, stream)+":KEPT", &redis.ZRangeBy{
+		Min: strconv.FormatUint(from, 10),
+		Max: strconv.FormatUint(until, 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*SequencedMessage, 0, len(vals))
+	for _, val := range vals {
+		data, _ := val.Member.(string)
+		list = append(list, &SequencedMessage{Seq: uint64(val.Score), Data: []byte(data)})
+	}
+	return list, nil
+}
+
+func (s *RedisSequenceStore) key(to, stream string) string {
+	return fmt.Sprintf("%s%s:%s", s.prefix, to, stream)
+}
+
+var (
+	detachScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	redis.call('PEXPIRE', KEYS[2], ARGV[2])
+end
+return 0`)
+
+	appendScript = redis.NewScript(`
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl < 0 then
+	return 0
+end
+redis.call('RPUSH', KEYS[2], ARGV[1])
+redis.call('LTRIM', KEYS[2], -tonumber(ARGV[2]), -1)
+redis.call('PEXPIRE', KEYS[2], ttl)
+return 1`)
+)
+
+// RedisResumeStore keeps the token of each recipient in a redis string, and its log in a redis list which
+// expires with the token.
+type RedisResumeStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+type RedisResumeStoreOption func(*RedisResumeStore)
+
+func WithResumePrefix(prefix string) RedisResumeStoreOption {
+	return func(s *RedisResumeStore) {
+		s.prefix = prefix
+	}
+}
+
+func NewRedisResumeStore(client redis.UniversalClient, options ...RedisResumeStoreOption) *RedisResumeStore {
+	s := &RedisResumeStore{
+		client: client,
+		prefix: "RAINDROP_RESUME:",
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+func (s *RedisResumeStore) Issue(ctx context.Context, to, token string, ttl time.Duration) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, s.tokenKey(to), token, ttl)
+		pipe.PExpire(ctx, s.logKey(to), ttl)
+		return nil
+	})
+	return err
+}
+
+func (s *RedisResumeStore) Token(ctx context.Context, to string) (string, error) {
+	token, err := s.client.Get(ctx, s.tokenKey(to)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrResumeNotFound
+	}
+	return token, err
+}
+
+func (s *RedisResumeStore) Detach(ctx context.Context, to, token string, ttl time.Duration) error {
+	keys := []string{s.tokenKey(to), s.logKey(to)}
+	return detachScript.Run(ctx, s.client, keys, token, ttl.Milliseconds()).Err()
+}
+
+func (s *RedisResumeStore) Append(ctx context.Context, to string, entry *LogEntry, max int) error {
+	val, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	keys := []string{s.tokenKey(to), s.logKey(to)}
+	appended, err := appendScript.Run(ctx, s.client, keys, val, max).Int()
+	if err != nil {
+		return err
+	}
+	if appended == 0 {
+		return ErrResumeNotFound
+	}
+	return nil
+}
+
+func (s *RedisResumeStore) Log(ctx context.Context, to string) ([]*LogEntry, error) {
+	vals, err := s.client.LRange(ctx, s.logKey(to), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	log := make([]*LogEntry, 0, len(vals))
+	for _, val := range vals {
+		entry := new(LogEntry)
+		if err := json.Unmarshal([]byte(val), entry); err != nil {
+			return nil, err
+		}
+		log = append(log, entry)
+	}
+	return log, nil
+}
+
+func (s *RedisResumeStore) Remove(ctx context.Context, to string, entries []*LogEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, entry := range entries {
+			// the entries are encoded as they are appended, the first equal one is the oldest
+			val, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			pipe.LRem(ctx, s.logKey(to), 1, val)
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *RedisResumeStore) tokenKey(to string) string {
+	// the keys of a recipient share a hash slot, so that the scripts run on a redis cluster
+	return fmt.Sprintf("%stoken:{%s}", s.prefix, to)
+}
+
+func (s *RedisResumeStore) logKey(to string) string {
+	return fmt.Sprintf("%slog:{%s}", s.prefix, to)
+}
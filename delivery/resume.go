@@ -0,0 +1,188 @@
+package delivery
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cro4k/raindrop/core"
+	"github.com/cro4k/raindrop/envelope"
+	"github.com/google/uuid"
+)
+
+const (
+	// ResumeParam is the handshake parameter of the resume token, e.g. `?resume=<token>`.
+	ResumeParam = "resume"
+	// LastSeqParam is the handshake parameter of the last sequence received by the client in a stream, it is
+	// repeated for each stream, e.g. `?last_seq=12&last_seq=chat:40` where the first one is of the default stream.
+	LastSeqParam = "last_seq"
+
+	DefaultResumeWindow  = 2 * time.Minute
+	DefaultResumeLogSize = 1024
+
+	// connectedTTL is the TTL of the token of a connected session, in case the node is gone before it is detached.
+	connectedTTL = 24 * time.Hour
+)
+
+// Resumer is a core.Interceptor which resumes the sessions after a reconnect, possibly to another node. An
+// envelope.TypeResume is written to each session when it is opened, whose token resumes the session within the
+// resume window after it is closed. The outbound messages of a session are kept in a log of the ResumeStore, so
+// are the messages written when the recipient is not connected. When the client reconnects with the token, the
+// messages after its last sequences are written again before the other messages. When it reconnects without a
+// valid token, only the messages written when it was not connected are delivered.
+//
+// The Resumer must follow the Sequencer, the messages without a sequence are not logged.
+type Resumer struct {
+	store   ResumeStore
+	window  time.Duration
+	logSize int
+}
+
+type ResumerOption func(*Resumer)
+
+// WithResumeWindow sets how long a closed session can be resumed.
+func WithResumeWindow(window time.Duration) ResumerOption {
+	return func(r *Resumer) {
+		r.window = window
+	}
+}
+
+// WithResumeLogSize sets how many messages are kept in the log of a session.
+func WithResumeLogSize(size int) ResumerOption {
+	return func(r *Resumer) {
+		r.logSize = size
+	}
+}
+
+func NewResumer(store ResumeStore, options ...ResumerOption) *Resumer {
+	r := &Resumer{store: store, window: DefaultResumeWindow, logSize: DefaultResumeLogSize}
+	for _, option := range options {
+		option(r)
+	}
+	return r
+}
+
+type resumeTokenKey struct{}
+
+func (r *Resumer) Outbound(ctx context.Context, s *core.Session, data []byte) ([]byte, error) {
+	if core.IsRewrite(ctx) {
+		return data, nil
+	}
+	e, _, err := envelope.Decode(data)
+	if err != nil || e.GetType() != envelope.TypeMessage || e.GetSeq() == 0 {
+		return data, nil
+	}
+	entry := &LogEntry{Stream: e.Header(envelope.HeaderStream), Seq: e.GetSeq(), Data: data}
+	if err := r.store.Append(ctx, s.ID, entry, r.logSize); err != nil {
+		slog.ErrorContext(ctx, "append resume log failed", slog.String("id", s.ID), slog.String("error", err.Error()))
+	}
+	return data, nil
+}
+
+func (r *Resumer) Inbound(ctx context.Context, s *core.Session, data []byte) ([]byte, error) {
+	return data, nil
+}
+
+// WriteOffline keeps the message in the log of the recipient whose session can be resumed.
+func (r *Resumer) WriteOffline(ctx context.Context, to string, data []byte) (bool, error) {
+	e, _, err := envelope.Decode(data)
+	if err != nil || e.GetType() != envelope.TypeMessage {
+		return false, nil
+	}
+	err = r.store.Append(ctx, to, &LogEntry{Stream: e.Header(envelope.HeaderStream), Data: data}, r.logSize)
+	if errors.Is(err, ErrResumeNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// SessionOpened issues a new token to the session, and replays the log.
+func (r *Resumer) SessionOpened(ctx context.Context, s *core.Session) {
+	token, err := r.store.Token(ctx, s.ID)
+	if err != nil && !errors.Is(err, ErrResumeNotFound) {
+		slog.ErrorContext(ctx, "get resume token failed", slog.String("id", s.ID), slog.String("error", err.Error()))
+	}
+	resumed := token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.Params.Get(ResumeParam))) == 1
+	log, err := r.store.Log(ctx, s.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "get resume log failed", slog.String("id", s.ID), slog.String("error", err.Error()))
+	}
+
+	token = uuid.NewString()
+	if err := r.store.Issue(ctx, s.ID, token, connectedTTL); err != nil {
+		slog.ErrorContext(ctx, "issue resume token failed", slog.String("id", s.ID), slog.String("error", err.Error()))
+		return
+	}
+	s.SetValue(resumeTokenKey{}, token)
+	e := envelope.New(envelope.TypeResume, nil)
+	e.SetHeader(envelope.HeaderResumeToken, token)
+	data, err := envelope.Encode(e, envelope.FormatBinary)
+	if err == nil {
+		err = s.Write(ctx, data)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "write resume token failed", slog.String("id", s.ID), slog.String("error", err.Error()))
+		return
+	}
+	r.replay(ctx, s, log, resumed)
+}
+
+// replay writes the log to the session. If the session is resumed, the entries after the last sequences of the
+// client are written again, otherwise the entries of the former session are dropped. The entries written when the
+// client is not connected get their sequences now, and they are removed from the log once they are written.
+func (r *Resumer) replay(ctx context.Context, s *core.Session, log []*LogEntry, resumed bool) {
+	last := lastSequences(s.Params[LastSeqParam])
+	var done []*LogEntry
+	for _, entry := range log {
+		var err error
+		switch {
+		case entry.Seq == 0:
+			if err = s.Write(ctx, entry.Data); err == nil {
+				done = append(done, entry)
+			}
+		case !resumed:
+			done = append(done, entry)
+		case entry.Seq > last[entry.Stream]:
+			err = s.Write(core.Rewrite(ctx), entry.Data)
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "replay message failed", slog.String("id", s.ID), slog.String("error", err.Error()))
+			break
+		}
+	}
+	if err := r.store.Remove(ctx, s.ID, done); err != nil {
+		slog.ErrorContext(ctx, "remove resume log failed", slog.String("id", s.ID), slog.String("error", err.Error()))
+	}
+}
+
+func lastSequences(params []string) map[string]uint64 {
+	last := make(map[string]uint64)
+	for _, param := range params {
+		i := strings.LastIndexByte(param, ':')
+		seq, err := strconv.ParseUint(param[i+1:], 10, 64)
+		if err != nil {
+			continue
+		}
+		if i < 0 {
+			last[""] = seq
+		} else {
+			last[param[:i]] = seq
+		}
+	}
+	return last
+}
+
+// SessionClosed keeps the token and the log of the session for the resume window.
+func (r *Resumer) SessionClosed(ctx context.Context, s *core.Session) {
+	token, ok := s.Value(resumeTokenKey{})
+	if !ok {
+		return
+	}
+	if err := r.store.Detach(context.WithoutCancel(ctx), s.ID, token.(string), r.window); err != nil {
+		slog.ErrorContext(ctx, "detach resume token failed", slog.String("id", s.ID), slog.String("error", err.Error()))
+	}
+}
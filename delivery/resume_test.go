@@ -0,0 +1,194 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/cro4k/raindrop/core"
+	"github.com/cro4k/raindrop/envelope"
+)
+
+type testConn struct {
+	params url.Values
+	frames chan []byte
+	done   chan struct{}
+	closed chan struct{}
+}
+
+func newTestConn(params url.Values) *testConn {
+	return &testConn{
+		params: params,
+		frames: make(chan []byte, 16),
+		done:   make(chan struct{}),
+		closed: make(chan struct{}),
+	}
+}
+
+func (c *testConn) Read(ctx context.Context) ([]byte, error) {
+	select {
+	case <-c.done:
+		return nil, errors.New("disconnected")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *testConn) Write(ctx context.Context, data []byte) error {
+	c.frames <- data
+	return nil
+}
+
+func (c *testConn) Close() error {
+	close(c.closed)
+	return nil
+}
+
+func (c *testConn) Subprotocol() string { return "" }
+
+func (c *testConn) Params() url.Values { return c.params }
+
+type testListener struct {
+	serve chan func(id string, conn core.Conn) error
+}
+
+func (l *testListener) Serve(ctx context.Context, f func(id string, conn core.Conn) error) error {
+	l.serve <- f
+	<-ctx.Done()
+	return nil
+}
+
+func (l *testListener) Close() error { return nil }
+
+type resumeTest struct {
+	t     *testing.T
+	srv   *core.Server
+	serve func(id string, conn core.Conn) error
+}
+
+func newResumeTest(t *testing.T, interceptors ...core.Interceptor) *resumeTest {
+	l := &testListener{serve: make(chan func(id string, conn core.Conn) error)}
+	srv := core.NewServer(l, core.WithInterceptors(interceptors...))
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go srv.Start(ctx)
+	return &resumeTest{t: t, srv: srv, serve: <-l.serve}
+}
+
+// connect connects the client, and returns the token of the session.
+func (rt *resumeTest) connect(params url.Values) (*testConn, string) {
+	conn := newTestConn(params)
+	if err := rt.serve("1", conn); err != nil {
+		rt.t.Fatal(err)
+	}
+	e := rt.next(conn)
+	if e.GetType() != envelope.TypeResume {
+		rt.t.Fatalf("got %s, want %s", e.GetType(), envelope.TypeResume)
+	}
+	return conn, e.Header(envelope.HeaderResumeToken)
+}
+
+func (rt *resumeTest) disconnect(conn *testConn) {
+	close(conn.done)
+	<-conn.closed
+	for {
+		if _, ok := rt.srv.Session("1"); !ok {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (rt *resumeTest) write(payload string) {
+	data, err := envelope.Encode(envelope.New(envelope.TypeMessage, []byte(payload)), envelope.FormatBinary)
+	if err != nil {
+		rt.t.Fatal(err)
+	}
+	if err := rt.srv.WriteTo(context.Background(), "1", data); err != nil {
+		rt.t.Fatal(err)
+	}
+}
+
+func (rt *resumeTest) next(conn *testConn) *envelope.Envelope {
+	select {
+	case data := <-conn.frames:
+		e, _, err := envelope.Decode(data)
+		if err != nil {
+			rt.t.Fatal(err)
+		}
+		return e
+	case <-time.After(time.Second):
+		rt.t.Fatal("no frame is written")
+		return nil
+	}
+}
+
+func (rt *resumeTest) expect(conn *testConn, payload string, seq uint64) {
+	e := rt.next(conn)
+	if string(e.GetPayload()) != payload || e.GetSeq() != seq {
+		rt.t.Fatalf("got %q (seq %d), want %q (seq %d)", e.GetPayload(), e.GetSeq(), payload, seq)
+	}
+}
+
+func (rt *resumeTest) expectNone(conn *testConn) {
+	select {
+	case data := <-conn.frames:
+		e, _, _ := envelope.Decode(data)
+		rt.t.Fatalf("unexpected frame %q (seq %d)", e.GetPayload(), e.GetSeq())
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestResumerResume(t *testing.T) {
+	rt := newResumeTest(t, NewSequencer(NewMemorySequenceStore()), NewResumer(NewMemoryResumeStore()))
+	conn, token := rt.connect(nil)
+	rt.write("a")
+	rt.write("b")
+	rt.expect(conn, "a", 1)
+	rt.expect(conn, "b", 2)
+	rt.disconnect(conn)
+	rt.write("c")
+
+	conn, token = rt.connect(url.Values{ResumeParam: {token}, LastSeqParam: {"1"}})
+	rt.expect(conn, "b", 2)
+	rt.expect(conn, "c", 3)
+	rt.expectNone(conn)
+	rt.disconnect(conn)
+
+	// the offline message is removed once it is written, and it is kept by its sequence
+	conn, _ = rt.connect(url.Values{ResumeParam: {token}, LastSeqParam: {"2"}})
+	rt.expect(conn, "c", 3)
+	rt.expectNone(conn)
+}
+
+func TestResumerReconnect(t *testing.T) {
+	rt := newResumeTest(t, NewSequencer(NewMemorySequenceStore()), NewResumer(NewMemoryResumeStore()))
+	conn, _ := rt.connect(nil)
+	rt.write("a")
+	rt.expect(conn, "a", 1)
+	rt.disconnect(conn)
+	rt.write("b")
+
+	conn, token := rt.connect(url.Values{ResumeParam: {"invalid"}})
+	rt.expect(conn, "b", 2)
+	rt.expectNone(conn)
+	rt.disconnect(conn)
+
+	// the messages of the former session are dropped
+	conn, _ = rt.connect(url.Values{ResumeParam: {token}})
+	rt.expect(conn, "b", 2)
+	rt.expectNone(conn)
+}
+
+func TestResumerWithoutSequencer(t *testing.T) {
+	rt := newResumeTest(t, NewResumer(NewMemoryResumeStore()))
+	conn, token := rt.connect(nil)
+	rt.write("a")
+	rt.expect(conn, "a", 0)
+	rt.disconnect(conn)
+
+	conn, _ = rt.connect(url.Values{ResumeParam: {token}})
+	rt.expectNone(conn)
+}
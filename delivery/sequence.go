@@ -0,0 +1,136 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/cro4k/raindrop/core"
+	"github.com/cro4k/raindrop/envelope"
+)
+
+const DefaultRetransmitBufferSize = 256
+
+var ErrSequenceUnavailable = errors.New("sequence is unavailable")
+
+// Sequencer is a core.Interceptor which stamps a sequence in each outbound envelope of envelope.TypeMessage. The
+// sequences increase monotonically per recipient and envelope.HeaderStream, so that the client detects the gaps,
+// and asks for the missing messages by an envelope.TypeResend whose Range is the missing sequences. The last
+// messages of each recipient and stream are kept in the SequenceStore to answer the resend requests, even after a
+// reconnect to another node, and the sequences which are not kept any more are answered by an envelope.TypeError
+// of ErrSequenceUnavailable with the Range.
+//
+// The frames of concurrent writers may reach the client in a different order than their sequences, so that the
+// client should wait a moment for a gap to be filled before it asks for a resend.
+//
+// The Sequencer should be the first interceptor, so that the retries of the Acknowledger keep their sequences.
+type Sequencer struct {
+	store      SequenceStore
+	bufferSize int
+}
+
+type SequencerOption func(*Sequencer)
+
+// WithRetransmitBufferSize sets how many messages of each recipient and stream are kept for the resend requests.
+func WithRetransmitBufferSize(size int) SequencerOption {
+	return func(s *Sequencer) {
+		s.bufferSize = size
+	}
+}
+
+// NewSequencer creates a sequencer, a shared store (e.g. RedisSequenceStore) keeps the sequences of a recipient
+// increasing when it reconnects to another node.
+func NewSequencer(store SequenceStore, options ...SequencerOption) *Sequencer {
+	s := &Sequencer{store: store, bufferSize: DefaultRetransmitBufferSize}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// missingRanges returns the ranges of the sequences in [from, until] which are not in the list, the list is in
+// the order of their sequences.
+func missingRanges(list []*SequencedMessage, from, until uint64) []*envelope.Range {
+	var missing []*envelope.Range
+	next := from
+	for _, m := range list {
+		if m.Seq > next {
+			missing = append(missing, &envelope.Range{From: next, To: m.Seq - 1})
+		}
+		next = m.Seq + 1
+	}
+	if from <= until && (len(list) == 0 || list[len(list)-1].Seq < until) {
+		missing = append(missing, &envelope.Range{From: next, To: until})
+	}
+	return missing
+}
+
+func (s *Sequencer) Outbound(ctx context.Context, session *core.Session, data []byte) ([]byte, error) {
+	if core.IsRewrite(ctx) {
+		return data, nil
+	}
+	e, format, err := envelope.Decode(data)
+	if err != nil || e.GetType() != envelope.TypeMessage {
+		return data, nil
+	}
+	stream := e.Header(envelope.HeaderStream)
+	e.Seq, err = s.store.Next(ctx, session.ID, stream)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = envelope.Encode(e, format); err != nil {
+		return nil, err
+	}
+	if err := s.store.Keep(ctx, session.ID, stream, &SequencedMessage{Seq: e.GetSeq(), Data: data}, s.bufferSize); err != nil {
+		slog.ErrorContext(ctx, "keep sequenced message failed", slog.String("id", session.ID),
+			slog.Uint64("seq", e.GetSeq()), slog.String("error", err.Error()))
+	}
+	return data, nil
+}
+
+func (s *Sequencer) Inbound(ctx context.Context, session *core.Session, data []byte) ([]byte, error) {
+	e, format, err := envelope.Decode(data)
+	if err != nil || e.GetType() != envelope.TypeResend {
+		return data, nil
+	}
+	s.resend(ctx, session, e, format)
+	return nil, nil
+}
+
+// resend writes the buffered messages of the range again, and reports the ranges of the missing ones.
+func (s *Sequencer) resend(ctx context.Context, session *core.Session, req *envelope.Envelope, format envelope.Format) {
+	stream := req.Header(envelope.HeaderStream)
+	from, until := req.GetRange().GetFrom(), req.GetRange().GetTo()
+	list, err := s.store.Range(ctx, session.ID, stream, from, until)
+	if err != nil {
+		slog.ErrorContext(ctx, "range sequenced messages failed", slog.String("id", session.ID),
+			slog.String("error", err.Error()))
+	}
+	for _, m := range list {
+		if err := session.Write(core.Rewrite(ctx), m.Data); err != nil {
+			slog.ErrorContext(ctx, "resend message failed", slog.String("id", session.ID),
+				slog.Uint64("seq", m.Seq), slog.String("error", err.Error()))
+			return
+		}
+	}
+	for _, r := range missingRanges(list, from, until) {
+		res := &envelope.Envelope{
+			Type:          envelope.TypeError,
+			CorrelationId: req.GetId(),
+			Timestamp:     time.Now().UnixMilli(),
+			Range:         r,
+		}
+		res.SetHeader(envelope.HeaderError, ErrSequenceUnavailable.Error())
+		res.SetHeader(envelope.HeaderStream, stream)
+		data, err := envelope.Encode(res, format)
+		if err == nil {
+			err = session.Write(core.Rewrite(ctx), data)
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "write unavailable sequences failed", slog.String("id", session.ID),
+				slog.String("error", err.Error()))
+			return
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package delivery
+
+import (
+	"cmp"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+var ErrInflightNotFound = errors.New("inflight message not found")
+
+// InflightMessage is a message written to a client and waiting for its acknowledgement.
+type InflightMessage struct {
+	ID          string    `json:"id"`
+	Data        []byte    `json:"data"`
+	Attempts    int       `json:"attempts"`
+	FirstSentAt time.Time `json:"first_sent_at"`
+}
+
+// InflightStore keeps the inflight messages of each recipient, a shared store (e.g. RedisInflightStore) lets the
+// inflight messages survive a reconnect to another node.
+type InflightStore interface {
+	Put(ctx context.Context, to string, m *InflightMessage) error
+	Get(ctx context.Context, to, id string) (*InflightMessage, error)
+	Delete(ctx context.Context, to, id string) error
+	// Attempt counts an attempt of the inflight message if it is still kept, so that an acknowledgement is never
+	// undone. If its attempts reach the max, the message is deleted and returned with exhausted set. It fails
+	// with ErrInflightNotFound if the message is acknowledged.
+	Attempt(ctx context.Context, to, id string, max int) (m *InflightMessage, exhausted bool, err error)
+	// List returns the inflight messages of the recipient in the order they were sent.
+	List(ctx context.Context, to string) ([]*InflightMessage, error)
+}
+
+type MemoryInflightStore struct {
+	mu       sync.Mutex
+	messages map[string]map[string]InflightMessage
+}
+
+// NewMemoryInflightStore creates an in-memory store, it is only suitable for a single node.
+func NewMemoryInflightStore() *MemoryInflightStore {
+	return &MemoryInflightStore{messages: make(map[string]map[string]InflightMessage)}
+}
+
+func (s *MemoryInflightStore) Put(ctx context.Context, to string, m *InflightMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	messages, ok := s.messages[to]
+	if !ok {
+		messages = make(map[string]InflightMessage)
+		s.messages[to] = messages
+	}
+	messages[m.ID] = *m
+	return nil
+}
+
+func (s *MemoryInflightStore) Get(ctx context.Context, to, id string) (*InflightMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.messages[to][id]
+	if !ok {
+		return nil, ErrInflightNotFound
+	}
+	return &m, nil
+}
+
+func (s *MemoryInflightStore) Delete(ctx context.Context, to, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.messages[to], id)
+	if len(s.messages[to]) == 0 {
+		delete(s.messages, to)
+	}
+	return nil
+}
+
+func (s *MemoryInflightStore) Attempt(ctx context.Context, to, id string, max int) (*InflightMessage, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.messages[to][id]
+	if !ok {
+		return nil, false, ErrInflightNotFound
+	}
+	if m.Attempts >= max {
+		delete(s.messages[to], id)
+		if len(s.messages[to]) == 0 {
+			delete(s.messages, to)
+		}
+		return &m, true, nil
+	}
+	m.Attempts++
+	s.messages[to][id] = m
+	return &m, false, nil
+}
+
+func (s *MemoryInflightStore) List(ctx context.Context, to string) ([]*InflightMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]*InflightMessage, 0, len(s.messages[to]))
+	for _, m := range s.messages[to] {
+		list = append(list, &m)
+	}
+	sortInflight(list)
+	return list, nil
+}
+
+func sortInflight(list []*InflightMessage) {
+	slices.SortFunc(list, func(a, b *InflightMessage) int {
+		return a.FirstSentAt.Compare(b.FirstSentAt)
+	})
+}
+
+// SequencedMessage is a message kept for the resend requests.
+type SequencedMessage struct {
+	Seq  uint64
+	Data []byte
+}
+
+// SequenceStore allocates the sequences of the messages per recipient and stream, and keeps the last messages of
+// each stream for the resend requests.
+type SequenceStore interface {
+	// Next returns the next sequence of the stream of the recipient, the first one is 1.
+	Next(ctx context.Context, to, stream string) (uint64, error)
+	// Keep keeps the message of the stream of the recipient, only the last max messages of the stream are kept.
+	Keep(ctx context.Context, to, stream string, m *SequencedMessage, max int) error
+	// Range returns the kept messages of the stream of the recipient whose sequences are in [from, until], in the
+	// order of their sequences.
+	Range(ctx context.Context, to, stream string, from, until uint64) ([]*SequencedMessage, error)
+}
+
+type sequenceKey struct {
+	to     string
+	stream string
+}
+
+type MemorySequenceStore struct {
+	mu        sync.Mutex
+	sequences map[sequenceKey]uint64
+	kept      map[sequenceKey][]*SequencedMessage
+}
+
+// NewMemorySequenceStore creates an in-memory store, it is only suitable for a single node.
+func NewMemorySequenceStore() *MemorySequenceStore {
+	return &MemorySequenceStore{
+		sequences: make(map[sequenceKey]uint64),
+		kept:      make(map[sequenceKey][]*SequencedMessage),
+	}
+}
+
+func (s *MemorySequenceStore) Next(ctx context.Context, to, stream string) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := sequenceKey{to: to, stream: stream}
+	s.sequences[key]++
+	return s.sequences[key], nil
+}
+
+func (s *MemorySequenceStore) Keep(ctx context.Context, to, stream string, m *SequencedMessage, max int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := sequenceKey{to: to, stream: stream}
+	kept := append(s.kept[key], m)
+	if len(kept) > max {
+		kept = slices.Delete(kept, 0, len(kept)-max)
+	}
+	s.kept[key] = kept
+	return nil
+}
+
+func (s *MemorySequenceStore) Range(ctx context.Context, to, stream string, from, until uint64) ([]*SequencedMessage, error) {
+	s.mu.Lock()
+	var list []*SequencedMessage
+	for _, m := range s.kept[sequenceKey{to: to, stream: stream}] {
+		if m.Seq >= from && m.Seq <= until {
+			list = append(list, m)
+		}
+	}
+	s.mu.Unlock()
+	slices.SortFunc(list, func(a, b *SequencedMessage) int {
+		return cmp.Compare(a.Seq, b.Seq)
+	})
+	return list, nil
+}
+
+var ErrResumeNotFound = errors.New("resumable session not found")
+
+// LogEntry is a message in the outbound log of a session, its sequence is 0 if it is written when the recipient
+// is not connected.
+type LogEntry struct {
+	Stream string `json:"stream,omitempty"`
+	Seq    uint64 `json:"seq,omitempty"`
+	Data   []byte `json:"data"`
+}
+
+// ResumeStore keeps the resume token and the outbound log of each recipient, a shared store (e.g.
+// RedisResumeStore) lets a session be resumed on another node.
+type ResumeStore interface {
+	// Issue binds the token to the recipient until the TTL, it replaces the former token.
+	Issue(ctx context.Context, to, token string, ttl time.Duration) error
+	// Token returns the token of the recipient, it fails with ErrResumeNotFound if there is none.
+	Token(ctx context.Context, to string) (string, error)
+	// Detach sets the TTL of the token of the recipient, if the token is still bound to it.
+	Detach(ctx context.Context, to, token string, ttl time.Duration) error
+	// Append appends the entry to the log of the recipient, the log keeps the last max entries, and it expires
+	// with the token. It fails with ErrResumeNotFound if the recipient has no token.
+	Append(ctx context.Context, to string, entry *LogEntry, max int) error
+	// Log returns the entries of the log in the order they are appended, the log is kept.
+	Log(ctx context.Context, to string) ([]*LogEntry, error)
+	// Remove removes the entries returned by Log from the log, the entries appended since are kept.
+	Remove(ctx context.Context, to string, entries []*LogEntry) error
+}
+
+type memoryResume struct {
+	token     string
+	expiresAt time.Time
+	log       []*LogEntry
+}
+
+type MemoryResumeStore struct {
+	mu      sync.Mutex
+	resumes map[string]*memoryResume
+}
+
+// NewMemoryResumeStore creates an in-memory store, it is only suitable for a single node.
+func NewMemoryResumeStore() *MemoryResumeStore {
+	return &MemoryResumeStore{resumes: make(map[string]*memoryResume)}
+}
+
+func (s *MemoryResumeStore) get(to string) (*memoryResume, bool) {
+	r, ok := s.resumes[to]
+	if ok && time.Now().After(r.expiresAt) {
+		delete(s.resumes, to)
+		return nil, false
+	}
+	return r, ok
+}
+
+func (s *MemoryResumeStore) Issue(ctx context.Context, to, token string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.get(to)
+	if !ok {
+		r = &memoryResume{}
+		s.resumes[to] = r
+	}
+	r.token = token
+	r.expiresAt = time.Now().Add(ttl)
+	return nil
+}
+
+func (s *MemoryResumeStore) Token(ctx context.Context, to string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.get(to)
+	if !ok {
+		return "", ErrResumeNotFound
+	}
+	return r.token, nil
+}
+
+func (s *MemoryResumeStore) Detach(ctx context.Context, to, token string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.get(to); ok && subtle.ConstantTimeCompare([]byte(r.token), []byte(token)) == 1 {
+		r.expiresAt = time.Now().Add(ttl)
+	}
+	return nil
+}
+
+func (s *MemoryResumeStore) Append(ctx context.Context, to string, entry *LogEntry, max int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.get(to)
+	if !ok {
+		return ErrResumeNotFound
+	}
+	r.log = append(r.log, entry)
+	if len(r.log) > max {
+		r.log = slices.Delete(r.log, 0, len(r.log)-max)
+	}
+	return nil
+}
+
+func (s *MemoryResumeStore) Log(ctx context.Context, to string) ([]*LogEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.get(to)
+	if !ok {
+		return nil, nil
+	}
+	return slices.Clone(r.log), nil
+}
+
+func (s *MemoryResumeStore) Remove(ctx context.Context, to string, entries []*LogEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.get(to); ok {
+		r.log = slices.DeleteFunc(r.log, func(entry *LogEntry) bool {
+			return slices.Contains(entries, entry)
+		})
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package envelope
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// TypeMessage is the type of the application messages.
+	TypeMessage = "message"
+	// TypeAck acknowledges the message whose id is the correlation id.
+	TypeAck = "ack"
+	// TypeRequest is a call which expects a TypeResponse whose correlation id is the id of the request.
+	TypeRequest = "request"
+	// TypeResponse answers the request whose id is the correlation id.
+	TypeResponse = "response"
+	// TypeError answers the envelope whose id is the correlation id with an error in the HeaderError header.
+	TypeError = "error"
+	// TypeFragment carries a piece of a larger frame, see Fragment.
+	TypeFragment = "fragment"
+	// TypeFragmentAck reports the count of the received fragments of a stream, which grants the sender more credits.
+	TypeFragmentAck = "fragment_ack"
+	// TypeResend asks for the messages of a stream whose sequences are in the Range.
+	TypeResend = "resend"
+	// TypeResume carries the token in the HeaderResumeToken header, which resumes the session after a reconnect.
+	TypeResume = "resume"
+	// TypeSubscribe subscribes the client to the topics matching the pattern in the HeaderTopic header, it is
+	// answered by a TypeAck, or a TypeError, whose correlation id is the id of the subscribe.
+	TypeSubscribe = "subscribe"
+	// TypeUnsubscribe unsubscribes the client from the pattern in the HeaderTopic header, it is answered as well.
+	TypeUnsubscribe = "unsubscribe"
+	// TypePresence sets the presence state of the client to the HeaderPresence header, it is answered as well. It is
+	// also the type of the presence changes pushed to the subscribers.
+	TypePresence = "presence"
+)
+
+const (
+	// HeaderCodec is the name of the codec which encodes the payload, e.g. "json".
+	HeaderCodec = "codec"
+	// HeaderMethod is the name of the server handler called by a client request.
+	HeaderMethod = "method"
+	// HeaderError is the error message of a failed response.
+	HeaderError = "error"
+	// HeaderCompression is the name of the algorithm which compresses the payload, e.g. "zstd".
+	HeaderCompression = "compression"
+	// HeaderStream is the stream of a message, the sequences of each stream of a recipient are independent.
+	HeaderStream = "stream"
+	// HeaderResumeToken is the token of a TypeResume envelope.
+	HeaderResumeToken = "resume_token"
+	// HeaderTopic is the topic of a published message, or the pattern of a TypeSubscribe or TypeUnsubscribe.
+	HeaderTopic = "topic"
+	// HeaderPresence is the presence state of a TypePresence, e.g. "online", "away" or "offline".
+	HeaderPresence = "presence"
+)
+
+// Format is the wire format of an envelope.
+type Format int
+
+const (
+	FormatBinary Format = iota
+	FormatJSON
+)
+
+var ErrInvalidEnvelope = errors.New("invalid envelope")
+
+// New creates an envelope with a random id and the current timestamp.
+func New(typ string, payload []byte) *Envelope {
+	return &Envelope{
+		Type:      typ,
+		Id:        uuid.NewString(),
+		Timestamp: time.Now().UnixMilli(),
+		Payload:   payload,
+	}
+}
+
+// Time returns the timestamp as time.Time.
+func (x *Envelope) Time() time.Time {
+	return time.UnixMilli(x.GetTimestamp())
+}
+
+// Header returns the value of the header.
+func (x *Envelope) Header(key string) string {
+	return x.GetHeaders()[key]
+}
+
+// SetHeader sets the value of the header.
+func (x *Envelope) SetHeader(key, val string) {
+	if x.Headers == nil {
+		x.Headers = make(map[string]string)
+	}
+	x.Headers[key] = val
+}
+
+// Encode encodes the envelope in the format.
+func Encode(e *Envelope, format Format) ([]byte, error) {
+	if format == FormatJSON {
+		return protojson.Marshal(e)
+	}
+	return proto.Marshal(e)
+}
+
+// Decode decodes the envelope in either format, and reports the detected format.
+// A binary envelope never starts with '{', so that JSON is detected by the first non-space byte.
+func Decode(data []byte) (*Envelope, Format, error) {
+	e := new(Envelope)
+	format := DetectFormat(data)
+	var err error
+	if format == FormatJSON {
+		err = protojson.Unmarshal(data, e)
+	} else {
+		err = proto.Unmarshal(data, e)
+	}
+	if err != nil {
+		return nil, format, errors.Join(ErrInvalidEnvelope, err)
+	}
+	if e.GetType() == "" {
+		return nil, format, ErrInvalidEnvelope
+	}
+	return e, format, nil
+}
+
+func DetectFormat(data []byte) Format {
+	data = bytes.TrimLeft(data, " \t\r\n")
+	if len(data) > 0 && data[0] == '{' {
+		return FormatJSON
+	}
+	return FormatBinary
+}
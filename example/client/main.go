@@ -73,7 +73,7 @@ func main() {
 			From:    clientID,
 			Content: message,
 		}
-		err = conn.Write(context.Background(), websocket.MessageBinary, m.JSON())
+		err = conn.Write(context.Background(), websocket.MessageBinary, m.Envelope())
 		if err != nil {
 			log.Println(err)
 		}
@@ -87,6 +87,11 @@ func read(conn *websocket.Conn) {
 			log.Println(err)
 			return
 		}
-		fmt.Println(">>:", string(data))
+		m, err := messages.Decode(data)
+		if err != nil {
+			fmt.Println(">>:", string(data))
+			continue
+		}
+		fmt.Println(">>:", string(m.JSON()))
 	}
 }
@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"flag"
 	"log/slog"
@@ -69,14 +68,14 @@ func main() {
 	r := raindrop.NewRaindrop(&raindrop.Options{
 		MessagePublisher:  nil,
 		MessageSubscriber: nil,
-		MessageResolver:   raindrop.MessageResolveFunc(messageResolver),
+		MessageResolver:   raindrop.RecipientResolver{Fallback: raindrop.MessageResolveFunc(messageResolver)},
 		Server:            srv,
 	})
 
 	ctx := context.Background()
 
 	// MQ is used when send message by this function, and we suggested send message to client in this way.
-	// r.Send(ctx, data)
+	// r.SendMessage(ctx, &raindrop.RawMessage{ID: id, Data: data, To: []string{to}})
 
 	defer r.Stop(ctx)
 	go r.Start(ctx)
@@ -87,9 +86,9 @@ func main() {
 }
 
 func onClientMessage(ctx context.Context, id string, data []byte, cb core.Writer) {
-	m := new(messages.Message)
-	if err := json.Unmarshal(data, m); err != nil {
-		slog.ErrorContext(ctx, "cannot unmarshal message", "error", err)
+	m, err := messages.Decode(data)
+	if err != nil {
+		slog.ErrorContext(ctx, "cannot decode message", "error", err)
 		return
 	}
 	slog.InfoContext(ctx, "IN",
@@ -104,8 +103,8 @@ func onClientMessage(ctx context.Context, id string, data []byte, cb core.Writer
 }
 
 func messageResolver(ctx context.Context, msg *raindrop.RawMessage) (destinations []string, err error) {
-	m := new(messages.Message)
-	if err := json.Unmarshal(msg.Data, m); err != nil {
+	m, err := messages.Decode(msg.Data)
+	if err != nil {
 		return nil, err
 	}
 	return []string{m.To}, nil
@@ -1,6 +1,10 @@
 package messages
 
-import "encoding/json"
+import (
+	"encoding/json"
+
+	"github.com/cro4k/raindrop/envelope"
+)
 
 type Message struct {
 	From    string `json:"from"`
@@ -12,3 +16,22 @@ func (m *Message) JSON() []byte {
 	b, _ := json.Marshal(m)
 	return b
 }
+
+// Envelope wraps the message in an envelope in JSON format.
+func (m *Message) Envelope() []byte {
+	b, _ := envelope.Encode(envelope.New(envelope.TypeMessage, m.JSON()), envelope.FormatJSON)
+	return b
+}
+
+// Decode decodes the message from an envelope in either format.
+func Decode(data []byte) (*Message, error) {
+	e, _, err := envelope.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	m := new(Message)
+	if err := json.Unmarshal(e.GetPayload(), m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"log/slog"
 	"net/http"
@@ -11,8 +10,10 @@ import (
 
 	"github.com/cro4k/raindrop"
 	"github.com/cro4k/raindrop/core"
+	"github.com/cro4k/raindrop/envelope"
 	"github.com/cro4k/raindrop/example/messages"
 	"github.com/cro4k/raindrop/protocol"
+	"github.com/cro4k/raindrop/router"
 )
 
 // This example is shown send message from clint-to-server side by websocket connection, so the MQ is skipped.
@@ -20,6 +21,8 @@ import (
 // distribute message, then the message is distributed by MQ. And the websocket connection should be only used for
 // server-to-client side communicate
 func main() {
+	rt := router.New()
+	rt.Handle(envelope.TypeMessage, router.Typed(onMessage))
 
 	srv := core.NewServer(
 		protocol.NewWebsocketServer(
@@ -32,7 +35,7 @@ func main() {
 				return id, nil
 			},
 		),
-		core.WithOnClientMessage(onClientMessage),
+		core.WithOnClientMessage(rt.OnClientMessage),
 	)
 
 	// mq := raindrop.NewInMemoryMessageQueue()
@@ -41,13 +44,13 @@ func main() {
 		// MQ is not used in this example, because the message is sent in callback, the MQ is skipped.
 		// MessagePublisher:  mq,
 		// MessageSubscriber: mq,
-		MessageResolver: raindrop.MessageResolveFunc(messageResolver),
+		MessageResolver: raindrop.RecipientResolver{Fallback: raindrop.MessageResolveFunc(messageResolver)},
 		Server:          srv,
 	})
 	ctx := context.Background()
 
 	// MQ is used when send message by this function, and we suggested send message to client in this way.
-	// r.Send(ctx, data)
+	// r.SendMessage(ctx, &raindrop.RawMessage{ID: id, Data: data, To: []string{to}})
 
 	go r.Start(ctx)
 	defer r.Stop(ctx)
@@ -57,26 +60,21 @@ func main() {
 	<-s
 }
 
-func onClientMessage(ctx context.Context, id string, data []byte, cb core.Writer) {
-	m := new(messages.Message)
-	if err := json.Unmarshal(data, m); err != nil {
-		slog.ErrorContext(ctx, "cannot unmarshal message", "error", err)
-		return
-	}
-	slog.InfoContext(ctx, "IN",
+func onMessage(c *router.Context, m *messages.Message) error {
+	slog.InfoContext(c, "IN",
 		slog.String("FROM", m.From),
 		slog.String("TO", m.To),
 		slog.String("CONTENT", m.Content),
 	)
 	if m.To == "" {
-		return
+		return errors.New("no recipient")
 	}
-	_ = cb.WriteTo(ctx, m.To, data)
+	return core.WriteEnvelope(c, c.Writer, m.To, c.Envelope)
 }
 
 func messageResolver(ctx context.Context, msg *raindrop.RawMessage) (destinations []string, err error) {
-	m := new(messages.Message)
-	if err := json.Unmarshal(msg.Data, m); err != nil {
+	m, err := messages.Decode(msg.Data)
+	if err != nil {
 		return nil, err
 	}
 	return []string{m.To}, nil
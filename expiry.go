@@ -0,0 +1,43 @@
+package raindrop
+
+import (
+	"context"
+	"time"
+
+	"github.com/cro4k/raindrop/core"
+)
+
+// WithMessageTTL sets the TTL of the sent messages whose context has no expiry (see core.WithExpiry), the TTL of
+// the scheduled messages starts when they are due. The messages do not expire by default.
+func WithMessageTTL(ttl time.Duration) OptionFunc {
+	return func(r *Raindrop) {
+		r.ttl = ttl
+	}
+}
+
+// Expired reports whether the message is expired at now.
+func (m *RawMessage) Expired(now time.Time) bool {
+	return !m.ExpiresAt.IsZero() && !now.Before(m.ExpiresAt)
+}
+
+// Expired returns the count of the messages which are dropped since they are expired.
+func (r *Raindrop) Expired() uint64 {
+	return r.expired.Load()
+}
+
+// expiry returns the expiry of the message sent with the context, from is the time the TTL starts.
+func (r *Raindrop) expiry(ctx context.Context, from time.Time) time.Time {
+	if expiry := core.ExpiryFromContext(ctx); !expiry.IsZero() {
+		return expiry
+	}
+	if r.ttl > 0 {
+		return from.Add(r.ttl)
+	}
+	return time.Time{}
+}
+
+// expire drops the expired message, it is counted and given to the dead letter sink.
+func (r *Raindrop) expire(ctx context.Context, m *RawMessage, destinations []string, attempts int) {
+	r.expired.Add(1)
+	r.deadLetter(ctx, m, core.ErrMessageExpired, destinations, attempts)
+}
@@ -0,0 +1,187 @@
+package fragment
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cro4k/raindrop/envelope"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrMessageTooLarge = errors.New("message is too large")
+	ErrInvalidFragment = errors.New("invalid fragment")
+	ErrTooManyStreams  = errors.New("too many streams")
+	ErrBufferFull      = errors.New("reassembly buffer is full")
+)
+
+const (
+	// MinFragmentSize is the min payload size of the fragments except the last one of a frame, so that a frame has
+	// at most one fragment per MinFragmentSize bytes.
+	MinFragmentSize = 1 << 10
+
+	// fragmentOverhead is the memory charged for each buffered fragment besides its payload.
+	fragmentOverhead = 64
+)
+
+// Split splits the frame into the envelopes of envelope.TypeFragment, whose payloads are at most size bytes.
+// The payloads share the memory of the frame.
+func Split(data []byte, size int) []*envelope.Envelope {
+	id := uuid.NewString()
+	count := (len(data) + size - 1) / size
+	list := make([]*envelope.Envelope, 0, count)
+	for i := 0; i < count; i++ {
+		list = append(list, newFragment(id, uint32(i), uint32(count), data, size))
+	}
+	return list
+}
+
+func newFragment(id string, index, count uint32, data []byte, size int) *envelope.Envelope {
+	offset := int(index) * size
+	return &envelope.Envelope{
+		Type:      envelope.TypeFragment,
+		Timestamp: time.Now().UnixMilli(),
+		Payload:   data[offset:min(offset+size, len(data))],
+		Fragment: &envelope.Fragment{
+			StreamId: id,
+			Index:    index,
+			Count:    count,
+			Size:     uint64(len(data)),
+		},
+	}
+}
+
+// Ack creates an envelope of envelope.TypeFragmentAck, which reports the count of the received fragments.
+func Ack(streamID string, received uint32) *envelope.Envelope {
+	return &envelope.Envelope{
+		Type:      envelope.TypeFragmentAck,
+		Timestamp: time.Now().UnixMilli(),
+		Fragment:  &envelope.Fragment{StreamId: streamID, Index: received},
+	}
+}
+
+type partial struct {
+	count     uint32
+	size      uint64
+	received  uint32
+	bytes     uint64
+	charged   uint64
+	fragments map[uint32][]byte
+	timer     *time.Timer
+}
+
+// Reassembler reassembles the fragments of the frames. A frame is dropped if it is larger than the max size,
+// or it is not completed within the timeout. The buffered fragments of all the frames are charged their payloads
+// and a fixed overhead against a budget of max size times max streams bytes, so that a flood of tiny fragments
+// is bounded as well.
+type Reassembler struct {
+	maxSize    int
+	timeout    time.Duration
+	maxStreams int
+	budget     uint64
+
+	mu      sync.Mutex
+	used    uint64
+	streams map[string]*partial
+}
+
+// NewReassembler creates a reassembler which reassembles at most maxStreams frames at the same time.
+func NewReassembler(maxSize int, timeout time.Duration, maxStreams int) *Reassembler {
+	return &Reassembler{
+		maxSize:    maxSize,
+		timeout:    timeout,
+		maxStreams: maxStreams,
+		budget:     uint64(maxSize) * uint64(maxStreams),
+		streams:    make(map[string]*partial),
+	}
+}
+
+// Add adds a fragment, and returns the frame when all its fragments are received. It also reports the count of
+// the received fragments of the frame.
+func (r *Reassembler) Add(e *envelope.Envelope) ([]byte, uint32, error) {
+	f := e.GetFragment()
+	if f.GetStreamId() == "" || f.GetCount() == 0 || f.GetIndex() >= f.GetCount() || uint64(f.GetCount()) > f.GetSize() ||
+		uint64(f.GetCount()) > (f.GetSize()+MinFragmentSize-1)/MinFragmentSize {
+		return nil, 0, ErrInvalidFragment
+	}
+	if len(e.GetPayload()) == 0 && f.GetIndex() != f.GetCount()-1 {
+		return nil, 0, ErrInvalidFragment
+	}
+	if f.GetSize() > uint64(r.maxSize) {
+		return nil, 0, ErrMessageTooLarge
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.streams[f.GetStreamId()]
+	if !ok {
+		if len(r.streams) >= r.maxStreams {
+			return nil, 0, ErrTooManyStreams
+		}
+		p = &partial{count: f.GetCount(), size: f.GetSize(), fragments: make(map[uint32][]byte)}
+		p.timer = time.AfterFunc(r.timeout, func() {
+			r.drop(f.GetStreamId(), p)
+		})
+		r.streams[f.GetStreamId()] = p
+	}
+	if p.count != f.GetCount() || p.size != f.GetSize() {
+		r.remove(f.GetStreamId())
+		return nil, 0, ErrInvalidFragment
+	}
+	if _, ok := p.fragments[f.GetIndex()]; ok {
+		return nil, p.received, nil
+	}
+	p.bytes += uint64(len(e.GetPayload()))
+	if p.bytes > p.size {
+		r.remove(f.GetStreamId())
+		return nil, 0, ErrMessageTooLarge
+	}
+	charge := uint64(len(e.GetPayload())) + fragmentOverhead
+	if r.used+charge > r.budget {
+		r.remove(f.GetStreamId())
+		return nil, 0, ErrBufferFull
+	}
+	r.used += charge
+	p.charged += charge
+	p.fragments[f.GetIndex()] = e.GetPayload()
+	p.received++
+	if p.received < p.count {
+		return nil, p.received, nil
+	}
+
+	r.remove(f.GetStreamId())
+	if p.bytes != p.size {
+		return nil, 0, ErrInvalidFragment
+	}
+	data := make([]byte, 0, p.size)
+	for i := uint32(0); i < p.count; i++ {
+		data = append(data, p.fragments[i]...)
+	}
+	return data, p.received, nil
+}
+
+// Close drops all the incomplete frames.
+func (r *Reassembler) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id := range r.streams {
+		r.remove(id)
+	}
+}
+
+func (r *Reassembler) drop(id string, p *partial) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.streams[id] == p {
+		r.used -= p.charged
+		delete(r.streams, id)
+	}
+}
+
+func (r *Reassembler) remove(id string) {
+	p := r.streams[id]
+	p.timer.Stop()
+	r.used -= p.charged
+	delete(r.streams, id)
+}
@@ -0,0 +1,252 @@
+package fragment
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/cro4k/raindrop/core"
+	"github.com/cro4k/raindrop/envelope"
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultFragmentSize      = 16 << 10
+	DefaultMaxMessageSize    = 64 << 20
+	DefaultReassemblyTimeout = 30 * time.Second
+	DefaultMaxStreams        = 4
+)
+
+// Fragmenter is a core.Interceptor which splits the outbound frames larger than the fragment size into fragments,
+// and reassembles the inbound fragments. The fragments are written one by one, so that the other frames of the
+// session are written between them, and at most the max streams frames of a session are fragmented at the same
+// time.
+//
+// With a window, the sender of the fragments waits for the fragment acks of the receiver when the window of
+// unacknowledged fragments is full, both the server and the clients should ack the fragments they receive.
+//
+// The Fragmenter should be the last interceptor, since the fragments are written to the connection directly.
+type Fragmenter struct {
+	fragmentSize   int
+	maxMessageSize int
+	timeout        time.Duration
+	maxStreams     int
+	window         uint32
+
+	mu sync.Mutex
+}
+
+type Option func(*Fragmenter)
+
+// WithFragmentSize sets the max payload size of the fragments, the frames up to this size are not fragmented. It
+// is at least MinFragmentSize.
+func WithFragmentSize(size int) Option {
+	return func(f *Fragmenter) {
+		f.fragmentSize = size
+	}
+}
+
+// WithMaxMessageSize sets the max size of the frames in both directions.
+func WithMaxMessageSize(size int) Option {
+	return func(f *Fragmenter) {
+		f.maxMessageSize = size
+	}
+}
+
+// WithReassemblyTimeout sets how long the fragments of an incomplete frame are kept.
+func WithReassemblyTimeout(timeout time.Duration) Option {
+	return func(f *Fragmenter) {
+		f.timeout = timeout
+	}
+}
+
+// WithMaxStreams sets how many frames of a session are fragmented at the same time in each direction.
+func WithMaxStreams(streams int) Option {
+	return func(f *Fragmenter) {
+		f.maxStreams = streams
+	}
+}
+
+// WithWindow sets the count of the fragments which are written without being acknowledged, it is 0 by default
+// which disables the flow control.
+func WithWindow(window uint32) Option {
+	return func(f *Fragmenter) {
+		f.window = window
+	}
+}
+
+func NewFragmenter(options ...Option) *Fragmenter {
+	f := &Fragmenter{
+		fragmentSize:   DefaultFragmentSize,
+		maxMessageSize: DefaultMaxMessageSize,
+		timeout:        DefaultReassemblyTimeout,
+		maxStreams:     DefaultMaxStreams,
+	}
+	for _, option := range options {
+		option(f)
+	}
+	f.fragmentSize = max(f.fragmentSize, MinFragmentSize)
+	return f
+}
+
+type stateKey struct{}
+
+// sessionState is the state of the fragmented frames of a session.
+type sessionState struct {
+	reassembler *Reassembler
+	slots       chan struct{}
+	closed      chan struct{}
+
+	mu       sync.Mutex
+	outgoing map[string]*outgoing
+}
+
+// outgoing is a frame being fragmented, acked is the count of the fragments acknowledged by the receiver.
+type outgoing struct {
+	acked  uint32
+	credit chan struct{}
+}
+
+func (f *Fragmenter) state(s *core.Session) *sessionState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if st, ok := s.Value(stateKey{}); ok {
+		return st.(*sessionState)
+	}
+	st := &sessionState{
+		reassembler: NewReassembler(f.maxMessageSize, f.timeout, f.maxStreams),
+		slots:       make(chan struct{}, f.maxStreams),
+		closed:      make(chan struct{}),
+		outgoing:    make(map[string]*outgoing),
+	}
+	s.SetValue(stateKey{}, st)
+	return st
+}
+
+func (f *Fragmenter) Outbound(ctx context.Context, s *core.Session, data []byte) ([]byte, error) {
+	if len(data) <= f.fragmentSize {
+		return data, nil
+	}
+	if len(data) > f.maxMessageSize {
+		return nil, ErrMessageTooLarge
+	}
+	st := f.state(s)
+	select {
+	case st.slots <- struct{}{}:
+	case <-st.closed:
+		return nil, core.ErrClientDisconnected
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-st.slots }()
+	return nil, f.send(ctx, s, st, data)
+}
+
+func (f *Fragmenter) send(ctx context.Context, s *core.Session, st *sessionState, data []byte) error {
+	id := uuid.NewString()
+	out := &outgoing{credit: make(chan struct{}, 1)}
+	st.mu.Lock()
+	st.outgoing[id] = out
+	st.mu.Unlock()
+	defer func() {
+		st.mu.Lock()
+		delete(st.outgoing, id)
+		st.mu.Unlock()
+	}()
+
+	format := envelope.DetectFormat(data)
+	count := (len(data) + f.fragmentSize - 1) / f.fragmentSize
+	for i := 0; i < count; i++ {
+		if err := f.wait(ctx, st, out, uint32(i)); err != nil {
+			return err
+		}
+		frame, err := envelope.Encode(newFragment(id, uint32(i), uint32(count), data, f.fragmentSize), format)
+		if err != nil {
+			return err
+		}
+		if err := s.WriteFrame(ctx, frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wait waits until the fragment of the index is in the window.
+func (f *Fragmenter) wait(ctx context.Context, st *sessionState, out *outgoing, index uint32) error {
+	if f.window == 0 {
+		return nil
+	}
+	for {
+		st.mu.Lock()
+		inWindow := index < out.acked+f.window
+		st.mu.Unlock()
+		if inWindow {
+			return nil
+		}
+		select {
+		case <-out.credit:
+		case <-st.closed:
+			return core.ErrClientDisconnected
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (f *Fragmenter) Inbound(ctx context.Context, s *core.Session, data []byte) ([]byte, error) {
+	e, format, err := envelope.Decode(data)
+	if err != nil {
+		return data, nil
+	}
+	switch e.GetType() {
+	case envelope.TypeFragmentAck:
+		f.state(s).ack(e.GetFragment())
+		return nil, nil
+	case envelope.TypeFragment:
+		data, received, err := f.state(s).reassembler.Add(e)
+		if err != nil {
+			return nil, err
+		}
+		if data == nil && f.window > 0 && received%max(f.window/2, 1) == 0 {
+			f.ack(ctx, s, e.GetFragment().GetStreamId(), received, format)
+		}
+		return data, nil
+	}
+	return data, nil
+}
+
+func (f *Fragmenter) ack(ctx context.Context, s *core.Session, id string, received uint32, format envelope.Format) {
+	frame, err := envelope.Encode(Ack(id, received), format)
+	if err == nil {
+		err = s.WriteFrame(ctx, frame)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "write fragment ack failed", slog.String("id", s.ID), slog.String("error", err.Error()))
+	}
+}
+
+func (st *sessionState) ack(fragment *envelope.Fragment) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	out, ok := st.outgoing[fragment.GetStreamId()]
+	if !ok || fragment.GetIndex() <= out.acked {
+		return
+	}
+	out.acked = fragment.GetIndex()
+	select {
+	case out.credit <- struct{}{}:
+	default:
+	}
+}
+
+func (f *Fragmenter) SessionOpened(ctx context.Context, s *core.Session) {
+	f.state(s)
+}
+
+// SessionClosed drops the incomplete inbound frames, and stops the outbound ones.
+func (f *Fragmenter) SessionClosed(ctx context.Context, s *core.Session) {
+	st := f.state(s)
+	close(st.closed)
+	st.reassembler.Close()
+}
@@ -0,0 +1,37 @@
+package group
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrGroupExists   = errors.New("group exists")
+	ErrGroupNotFound = errors.New("group is not found")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// Group is a group of clients, e.g. a chat room.
+type Group struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Store keeps the groups and their members.
+type Store interface {
+	// Create creates the group, it returns ErrGroupExists if there is a group of the id.
+	Create(ctx context.Context, g *Group) error
+	// Get returns the group, it returns ErrGroupNotFound if there is no group of the id.
+	Get(ctx context.Context, id string) (*Group, error)
+	// Delete deletes the group and its members.
+	Delete(ctx context.Context, id string) error
+	// Join adds the members to the group, and returns the ones which are not members before.
+	Join(ctx context.Context, id string, members ...string) ([]string, error)
+	// Leave removes the members from the group, and returns the ones which are members before.
+	Leave(ctx context.Context, id string, members ...string) ([]string, error)
+	// Members returns a page of at most limit members of the group from the cursor, which is empty for the first
+	// page, and the cursor of the next page, which is empty after the last page.
+	Members(ctx context.Context, id, cursor string, limit int) ([]string, string, error)
+}
@@ -0,0 +1,148 @@
+package group
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const DefaultPageSize = 1000
+
+type options struct {
+	prefix string
+	table  string
+}
+
+type Option func(*options)
+
+// WithPrefix sets the prefix of the keys of the RedisStore.
+func WithPrefix(prefix string) Option {
+	return func(o *options) {
+		o.prefix = prefix
+	}
+}
+
+// WithTable sets the table of the groups of the SQLiteStore, the members are kept in the table of the "_members"
+// suffix.
+func WithTable(table string) Option {
+	return func(o *options) {
+		o.table = table
+	}
+}
+
+func applyOptions(opts ...Option) *options {
+	o := &options{
+		prefix: "RAINDROP_GROUP:",
+		table:  "raindrop_groups",
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+var createScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'name', ARGV[1], 'created_at', ARGV[2])
+return 1`)
+
+// RedisStore keeps each group in a redis hash, and its members in a redis set. The members are listed by SSCAN,
+// so that a member may be listed more than once.
+type RedisStore struct {
+	client redis.UniversalClient
+	*options
+}
+
+func NewRedisStore(client redis.UniversalClient, opts ...Option) *RedisStore {
+	return &RedisStore{client: client, options: applyOptions(opts...)}
+}
+
+func (s *RedisStore) Create(ctx context.Context, g *Group) error {
+	ok, err := createScript.Run(ctx, s.client, []string{s.groupKey(g.ID)}, g.Name, g.CreatedAt.UnixMilli()).Bool()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrGroupExists
+	}
+	return nil
+}
+
+func (s *RedisStore) Get(ctx context.Context, id string) (*Group, error) {
+	values, err := s.client.HGetAll(ctx, s.groupKey(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, ErrGroupNotFound
+	}
+	createdAt, _ := strconv.ParseInt(values["created_at"], 10, 64)
+	return &Group{ID: id, Name: values["name"], CreatedAt: time.UnixMilli(createdAt)}, nil
+}
+
+func (s *RedisStore) Delete(ctx context.Context, id string) error {
+	return s.client.Del(ctx, s.groupKey(id), s.membersKey(id)).Err()
+}
+
+func (s *RedisStore) Join(ctx context.Context, id string, members ...string) ([]string, error) {
+	return s.update(ctx, members, func(pipe redis.Pipeliner, member string) *redis.IntCmd {
+		return pipe.SAdd(ctx, s.membersKey(id), member)
+	})
+}
+
+func (s *RedisStore) Leave(ctx context.Context, id string, members ...string) ([]string, error) {
+	return s.update(ctx, members, func(pipe redis.Pipeliner, member string) *redis.IntCmd {
+		return pipe.SRem(ctx, s.membersKey(id), member)
+	})
+}
+
+// update adds or removes the members by a command of each member in pages, and returns the changed ones.
+func (s *RedisStore) update(ctx context.Context, members []string, f func(pipe redis.Pipeliner, member string) *redis.IntCmd) ([]string, error) {
+	var changed []string
+	for start := 0; start < len(members); start += DefaultPageSize {
+		page := members[start:min(start+DefaultPageSize, len(members))]
+		cmds := make([]*redis.IntCmd, len(page))
+		_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, member := range page {
+				cmds[i] = f(pipe, member)
+			}
+			return nil
+		})
+		if err != nil {
+			return changed, err
+		}
+		for i, cmd := range cmds {
+			if cmd.Val() > 0 {
+				changed = append(changed, page[i])
+			}
+		}
+	}
+	return changed, nil
+}
+
+func (s *RedisStore) Members(ctx context.Context, id, cursor string, limit int) ([]string, string, error) {
+	var c uint64
+	if cursor != "" {
+		var err error
+		if c, err = strconv.ParseUint(cursor, 10, 64); err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+	}
+	members, next, err := s.client.SScan(ctx, s.membersKey(id), c, "", int64(limit)).Result()
+	if err != nil || next == 0 {
+		return members, "", err
+	}
+	return members, strconv.FormatUint(next, 10), nil
+}
+
+func (s *RedisStore) groupKey(id string) string {
+	return s.prefix + "{" + id + "}"
+}
+
+func (s *RedisStore) membersKey(id string) string {
+	return s.prefix + "{" + id + "}:MEMBERS"
+}
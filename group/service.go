@@ -0,0 +1,192 @@
+package group
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cro4k/raindrop"
+	"github.com/cro4k/raindrop/envelope"
+	"github.com/google/uuid"
+)
+
+const (
+	// HeaderGroup is the header of the messages sent to a group, and of the envelopes of the events.
+	HeaderGroup = "group"
+	// HeaderEvent is the type of the event in the envelopes of the events.
+	HeaderEvent = "event"
+
+	EventJoined = "joined"
+	EventLeft   = "left"
+
+	// MaxEventMembers is the max count of the members in an event, so that the event of a bulk change is small.
+	MaxEventMembers = 100
+)
+
+// Event is a membership change of a group, it is the json payload of the event envelopes sent to the group.
+type Event struct {
+	Type  string `json:"type"`
+	Group string `json:"group"`
+	// Members are the changed members, at most MaxEventMembers of them, and Count is the count of all of them.
+	Members []string  `json:"members"`
+	Count   int       `json:"count"`
+	At      time.Time `json:"at"`
+}
+
+// Sender sends the messages, e.g. raindrop.Raindrop.
+type Sender interface {
+	SendMessage(ctx context.Context, m *raindrop.RawMessage) error
+}
+
+// Service manages the groups, and resolves the messages sent to a group to its members.
+type Service struct {
+	store    Store
+	sender   Sender
+	pageSize int
+}
+
+type ServiceOption func(*Service)
+
+// WithSender sets the sender of the messages sent by Send, and of the membership events. The events are not sent
+// without a sender.
+func WithSender(sender Sender) ServiceOption {
+	return func(s *Service) {
+		s.sender = sender
+	}
+}
+
+// WithPageSize sets the count of the members which are read from the store at a time.
+func WithPageSize(size int) ServiceOption {
+	return func(s *Service) {
+		s.pageSize = size
+	}
+}
+
+func NewService(store Store, options ...ServiceOption) *Service {
+	s := &Service{store: store, pageSize: DefaultPageSize}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+func (s *Service) Create(ctx context.Context, id, name string) (*Group, error) {
+	g := &Group{ID: id, Name: name, CreatedAt: time.Now()}
+	if err := s.store.Create(ctx, g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (s *Service) Get(ctx context.Context, id string) (*Group, error) {
+	return s.store.Get(ctx, id)
+}
+
+func (s *Service) Delete(ctx context.Context, id string) error {
+	return s.store.Delete(ctx, id)
+}
+
+// Join adds the members to the group, and sends an event of EventJoined to the group.
+func (s *Service) Join(ctx context.Context, id string, members ...string) error {
+	if _, err := s.store.Get(ctx, id); err != nil {
+		return err
+	}
+	joined, err := s.store.Join(ctx, id, members...)
+	if err != nil || len(joined) == 0 {
+		return err
+	}
+	return s.notify(ctx, EventJoined, id, joined, nil)
+}
+
+// Leave removes the members from the group, and sends an event of EventLeft to the group and the removed members,
+// at most MaxEventMembers of them.
+func (s *Service) Leave(ctx context.Context, id string, members ...string) error {
+	left, err := s.store.Leave(ctx, id, members...)
+	if err != nil || len(left) == 0 {
+		return err
+	}
+	return s.notify(ctx, EventLeft, id, left, left[:min(len(left), MaxEventMembers)])
+}
+
+// Members returns all the members of the group.
+func (s *Service) Members(ctx context.Context, id string) ([]string, error) {
+	return s.expand(ctx, id, nil)
+}
+
+// Send sends the data to the members of the group.
+func (s *Service) Send(ctx context.Context, id string, data []byte) error {
+	if s.sender == nil {
+		return fmt.Errorf("sender is not set")
+	}
+	m := &raindrop.RawMessage{ID: uuid.NewString(), Data: data}
+	m.SetHeader(HeaderGroup, id)
+	return s.sender.SendMessage(ctx, m)
+}
+
+// Resolve resolves the message to the members of its group (HeaderGroup), and its recipients (RawMessage.To). It
+// implements raindrop.MessageResolver, and it fails with ErrGroupNotFound if the group does not exist, so that the
+// message is a dead letter.
+func (s *Service) Resolve(ctx context.Context, m *raindrop.RawMessage) ([]string, error) {
+	id := m.Header(HeaderGroup)
+	if id == "" {
+		return m.To, nil
+	}
+	if _, err := s.store.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.expand(ctx, id, m.To)
+}
+
+// expand returns the members of the group and the recipients, each of them is returned once.
+func (s *Service) expand(ctx context.Context, id string, recipients []string) ([]string, error) {
+	seen := make(map[string]struct{})
+	var list []string
+	add := func(ids []string) {
+		for _, id := range ids {
+			if _, ok := seen[id]; !ok {
+				seen[id] = struct{}{}
+				list = append(list, id)
+			}
+		}
+	}
+	add(recipients)
+	cursor := ""
+	for {
+		members, next, err := s.store.Members(ctx, id, cursor, s.pageSize)
+		if err != nil {
+			return nil, err
+		}
+		add(members)
+		if next == "" {
+			return list, nil
+		}
+		cursor = next
+	}
+}
+
+// notify sends the event to the group and the recipients.
+func (s *Service) notify(ctx context.Context, typ, id string, members, recipients []string) error {
+	if s.sender == nil {
+		return nil
+	}
+	e := envelope.New(envelope.TypeMessage, nil)
+	e.SetHeader(HeaderEvent, typ)
+	e.SetHeader(HeaderGroup, id)
+	event := &Event{
+		Type:    typ,
+		Group:   id,
+		Members: members[:min(len(members), MaxEventMembers)],
+		Count:   len(members),
+		At:      time.Now(),
+	}
+	if err := raindrop.MarshalPayload(e, raindrop.JSONCodec{}, event); err != nil {
+		return err
+	}
+	data, err := envelope.Encode(e, envelope.FormatBinary)
+	if err != nil {
+		return err
+	}
+	m := &raindrop.RawMessage{ID: e.Id, Data: data, To: recipients}
+	m.SetHeader(HeaderGroup, id)
+	return s.sender.SendMessage(ctx, m)
+}
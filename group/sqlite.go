@@ -0,0 +1,147 @@
+package group
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SQLiteStore keeps the groups and their members in sqlite tables. The database is opened by the application with
+// the driver of its choice, e.g. github.com/mattn/go-sqlite3 or modernc.org/sqlite.
+type SQLiteStore struct {
+	db *sql.DB
+	*options
+}
+
+// NewSQLiteStore creates the store, and the tables if they do not exist.
+func NewSQLiteStore(ctx context.Context, db *sql.DB, opts ...Option) (*SQLiteStore, error) {
+	s := &SQLiteStore{db: db, options: applyOptions(opts...)}
+	for _, query := range []string{
+		`CREATE TABLE IF NOT EXISTS %[1]s (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	created_at INTEGER NOT NULL
+)`,
+		`CREATE TABLE IF NOT EXISTS %[1]s_members (
+	group_id TEXT NOT NULL,
+	member TEXT NOT NULL,
+	joined_at INTEGER NOT NULL,
+	PRIMARY KEY (group_id, member)
+)`,
+	} {
+		if _, err := db.ExecContext(ctx, fmt.Sprintf(query, s.table)); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *SQLiteStore) Create(ctx context.Context, g *Group) error {
+	res, err := s.db.ExecContext(ctx, fmt.Sprintf(
+		`INSERT OR IGNORE INTO %s (id, name, created_at) VALUES (?, ?, ?)`, s.table),
+		g.ID, g.Name, g.CreatedAt.UnixMilli())
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrGroupExists
+	}
+	return nil
+}
+
+func (s *SQLiteStore) Get(ctx context.Context, id string) (*Group, error) {
+	var (
+		g         = &Group{ID: id}
+		createdAt int64
+	)
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT name, created_at FROM %s WHERE id = ?`, s.table), id).
+		Scan(&g.Name, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrGroupNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	g.CreatedAt = time.UnixMilli(createdAt)
+	return g, nil
+}
+
+func (s *SQLiteStore) Delete(ctx context.Context, id string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s_members WHERE group_id = ?`, s.table), id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE id = ?`, s.table), id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) Join(ctx context.Context, id string, members ...string) ([]string, error) {
+	return s.update(ctx, fmt.Sprintf(
+		`INSERT OR IGNORE INTO %s_members (group_id, member, joined_at) VALUES (?, ?, ?)`, s.table),
+		id, members, time.Now().UnixMilli())
+}
+
+func (s *SQLiteStore) Leave(ctx context.Context, id string, members ...string) ([]string, error) {
+	return s.update(ctx, fmt.Sprintf(`DELETE FROM %s_members WHERE group_id = ? AND member = ?`, s.table),
+		id, members)
+}
+
+// update executes the statement for each member in a transaction, and returns the changed members.
+func (s *SQLiteStore) update(ctx context.Context, query, id string, members []string, args ...any) ([]string, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	var changed []string
+	for _, member := range members {
+		res, err := stmt.ExecContext(ctx, append([]any{id, member}, args...)...)
+		if err != nil {
+			return nil, err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return nil, err
+		} else if n > 0 {
+			changed = append(changed, member)
+		}
+	}
+	return changed, tx.Commit()
+}
+
+// Members lists the members in order, the cursor is the last member of the previous page.
+func (s *SQLiteStore) Members(ctx context.Context, id, cursor string, limit int) ([]string, string, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(
+		`SELECT member FROM %s_members WHERE group_id = ? AND member > ? ORDER BY member LIMIT ?`, s.table),
+		id, cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+	var members []string
+	for rows.Next() {
+		var member string
+		if err := rows.Scan(&member); err != nil {
+			return nil, "", err
+		}
+		members = append(members, member)
+	}
+	if err := rows.Err(); err != nil || len(members) < limit {
+		return members, "", err
+	}
+	return members, members[len(members)-1], nil
+}
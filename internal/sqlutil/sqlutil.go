@@ -0,0 +1,44 @@
+// Package sqlutil encodes the messages in the columns of the sqlite stores.
+package sqlutil
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/cro4k/raindrop"
+)
+
+// UnixNano returns the time in unix nanoseconds, it is 0 for the zero time.
+func UnixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// FromUnixNano returns the time of the unix nanoseconds, it is the zero time for 0.
+func FromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+// MarshalAttributes encodes the recipients and the headers of the message in json.
+func MarshalAttributes(m *raindrop.RawMessage) (to, headers []byte, err error) {
+	if to, err = json.Marshal(m.To); err != nil {
+		return nil, nil, err
+	}
+	if headers, err = json.Marshal(m.Headers); err != nil {
+		return nil, nil, err
+	}
+	return to, headers, nil
+}
+
+// UnmarshalAttributes decodes the recipients and the headers of the message.
+func UnmarshalAttributes(m *raindrop.RawMessage, to, headers []byte) error {
+	if err := json.Unmarshal(to, &m.To); err != nil {
+		return err
+	}
+	return json.Unmarshal(headers, &m.Headers)
+}
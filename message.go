@@ -8,9 +8,16 @@ import (
 
 type (
 	RawMessage struct {
-		ID        string
-		Data      []byte
-		Timestamp time.Time
+		ID   string `json:"id"`
+		Data []byte `json:"data"`
+		// To are the recipients of the message, so that the resolvers route it without decoding the data,
+		// e.g. RecipientResolver.
+		To []string `json:"to,omitempty"`
+		// Headers are the attributes of the message, e.g. the sender, the tenant or the trace context.
+		Headers   map[string]string `json:"headers,omitempty"`
+		Timestamp time.Time         `json:"timestamp"`
+		// ExpiresAt is the time after which the message is not delivered, it is zero if the message does not expire.
+		ExpiresAt time.Time `json:"expires_at"`
 	}
 
 	MessageResolver interface {
@@ -39,6 +46,32 @@ func (f MessageResolveFunc) Resolve(ctx context.Context, msg *RawMessage) (desti
 	return f(ctx, msg)
 }
 
+// RecipientResolver resolves the messages to their recipients (RawMessage.To), the messages without recipients
+// are resolved by the Fallback if it is not nil.
+type RecipientResolver struct {
+	Fallback MessageResolver
+}
+
+func (r RecipientResolver) Resolve(ctx context.Context, msg *RawMessage) (destinations []string, err error) {
+	if len(msg.To) > 0 || r.Fallback == nil {
+		return msg.To, nil
+	}
+	return r.Fallback.Resolve(ctx, msg)
+}
+
+// Header returns the value of the header, it is empty if the header is not set.
+func (m *RawMessage) Header(key string) string {
+	return m.Headers[key]
+}
+
+// SetHeader sets the value of the header.
+func (m *RawMessage) SetHeader(key, value string) {
+	if m.Headers == nil {
+		m.Headers = make(map[string]string)
+	}
+	m.Headers[key] = value
+}
+
 // NewInMemoryMessageQueue
 // Deprecated: you'd better make your own implementation.
 // In actually, an in-memory MQ is nonsensical.
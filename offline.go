@@ -0,0 +1,97 @@
+package raindrop
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/cro4k/raindrop/core"
+)
+
+const offlineBatchSize = 100
+
+// OfflineMessage is a message kept for a recipient which is not connected.
+type OfflineMessage struct {
+	// ID is assigned by the store.
+	ID       string     `json:"id"`
+	Message  RawMessage `json:"message"`
+	StoredAt time.Time  `json:"stored_at"`
+}
+
+// OfflineStore keeps the messages of the recipients which are not connected, until they connect.
+// The stores cap the messages of each recipient, and expire them after a TTL.
+type OfflineStore interface {
+	Put(ctx context.Context, to string, m *RawMessage) error
+	// List returns at most limit messages of the recipient in the order they are put.
+	List(ctx context.Context, to string, limit int) ([]*OfflineMessage, error)
+	Delete(ctx context.Context, to, id string) error
+}
+
+// WithOfflineStore keeps the messages of the recipients which are not connected in the store, instead of
+// failing them. The messages are delivered by OnClientConnected.
+func WithOfflineStore(store OfflineStore) OptionFunc {
+	return func(r *Raindrop) {
+		r.offline = store
+	}
+}
+
+// OnClientConnected delivers the offline messages of the client in order, it is the hook of
+// core.WithOnClientConnected, or it is called by the hook. The session is held while the messages are written, so
+// that the other messages to the client are queued after them. Each message is removed after it is written, if the
+// messages are acknowledged by the delivery.Acknowledger, they are kept by its inflight store from then on. The
+// expired messages are dropped.
+func (r *Raindrop) OnClientConnected(ctx context.Context, id string, cb core.Writer) {
+	if r.offline == nil {
+		return
+	}
+	s, ok := core.SessionFromContext(ctx)
+	if !ok {
+		return
+	}
+	ctx, release := s.Hold(ctx)
+	go func() {
+		defer release()
+		if err := r.drain(ctx, s); err != nil {
+			slog.ErrorContext(ctx, "deliver offline messages failed", slog.String("id", id),
+				slog.String("error", err.Error()))
+		}
+	}()
+}
+
+func (r *Raindrop) drain(ctx context.Context, s *core.Session) error {
+	for {
+		list, err := r.offline.List(ctx, s.ID, offlineBatchSize)
+		if err != nil || len(list) == 0 {
+			return err
+		}
+		for _, m := range list {
+			if m.Message.Expired(time.Now()) {
+				r.expire(ctx, &m.Message, []string{s.ID}, 0)
+			} else if err := s.Write(ctx, m.Message.Data); err != nil {
+				return err
+			}
+			if err := r.offline.Delete(ctx, s.ID, m.ID); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// putOffline keeps the message for the recipient, it reports false if there is no offline store. The expired
+// messages are dropped instead.
+func (r *Raindrop) putOffline(ctx context.Context, to string, m *RawMessage, err error) bool {
+	if r.offline == nil || !errors.Is(err, core.ErrClientConnectionNotFound) {
+		return false
+	}
+	if m.Expired(time.Now()) {
+		r.expire(ctx, m, []string{to}, 1)
+		return true
+	}
+	if err := r.offline.Put(ctx, to, m); err != nil {
+		slog.ErrorContext(ctx, "put offline message failed", slog.String("id", to),
+			slog.String("message", m.ID), slog.String("error", err.Error()))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+package offline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cro4k/raindrop"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	DefaultMaxMessages = 1000
+	DefaultTTL         = 7 * 24 * time.Hour
+
+	messageField = "message"
+)
+
+type options struct {
+	prefix      string
+	table       string
+	maxMessages int
+	ttl         time.Duration
+}
+
+type Option func(*options)
+
+// WithPrefix sets the prefix of the keys of the RedisStore.
+func WithPrefix(prefix string) Option {
+	return func(o *options) {
+		o.prefix = prefix
+	}
+}
+
+// WithTable sets the table of the SQLiteStore.
+func WithTable(table string) Option {
+	return func(o *options) {
+		o.table = table
+	}
+}
+
+// WithMaxMessages sets the max count of the messages of each recipient, the oldest ones are dropped.
+func WithMaxMessages(max int) Option {
+	return func(o *options) {
+		o.maxMessages = max
+	}
+}
+
+// WithTTL sets how long the messages are kept.
+func WithTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.ttl = ttl
+	}
+}
+
+func applyOptions(opts ...Option) *options {
+	o := &options{
+		prefix:      "RAINDROP_OFFLINE:",
+		table:       "raindrop_offline_messages",
+		maxMessages: DefaultMaxMessages,
+		ttl:         DefaultTTL,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// RedisStore keeps the offline messages of each recipient in a redis stream, the ids of the messages are the ids
+// of the entries.
+type RedisStore struct {
+	client redis.UniversalClient
+	*options
+}
+
+func NewRedisStore(client redis.UniversalClient, opts ...Option) *RedisStore {
+	return &RedisStore{client: client, options: applyOptions(opts...)}
+}
+
+func (s *RedisStore) Put(ctx context.Context, to string, m *raindrop.RawMessage) error {
+	val, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	key := s.key(to)
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{Stream: key, MaxLen: int64(s.maxMessages), Values: []any{messageField, val}})
+		pipe.XTrimMinID(ctx, key, s.minID())
+		pipe.Expire(ctx, key, s.ttl)
+		return nil
+	})
+	return err
+}
+
+func (s *RedisStore) List(ctx context.Context, to string, limit int) ([]*raindrop.OfflineMessage, error) {
+	entries, err := s.client.XRangeN(ctx, s.key(to), s.minID(), "+", int64(limit)).Result()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*raindrop.OfflineMessage, 0, len(entries))
+	for _, entry := range entries {
+		val, _ := entry.Values[messageField].(string)
+		m := &raindrop.OfflineMessage{ID: entry.ID, StoredAt: entryTime(entry.ID)}
+		if err := json.Unmarshal([]byte(val), &m.Message); err != nil {
+			return nil, err
+		}
+		list = append(list, m)
+	}
+	return list, nil
+}
+
+func (s *RedisStore) Delete(ctx context.Context, to, id string) error {
+	return s.client.XDel(ctx, s.key(to), id).Err()
+}
+
+func (s *RedisStore) key(to string) string {
+	return fmt.Sprintf("%s%s", s.prefix, to)
+}
+
+// minID is the id of the oldest entries which are not expired.
+func (s *RedisStore) minID() string {
+	return strconv.FormatInt(time.Now().Add(-s.ttl).UnixMilli(), 10)
+}
+
+func entryTime(id string) time.Time {
+	ms, _, _ := strings.Cut(id, "-")
+	n, _ := strconv.ParseInt(ms, 10, 64)
+	return time.UnixMilli(n)
+}
@@ -0,0 +1,120 @@
+package offline
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/cro4k/raindrop"
+	"github.com/cro4k/raindrop/internal/sqlutil"
+)
+
+// SQLiteStore keeps the offline messages in a sqlite table. The database is opened by the application with the
+// driver of its choice, e.g. github.com/mattn/go-sqlite3 or modernc.org/sqlite.
+type SQLiteStore struct {
+	db *sql.DB
+	*options
+}
+
+// NewSQLiteStore creates the store, and the table if it does not exist.
+func NewSQLiteStore(ctx context.Context, db *sql.DB, opts ...Option) (*SQLiteStore, error) {
+	s := &SQLiteStore{db: db, options: applyOptions(opts...)}
+	_, err := db.ExecContext(ctx, fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %s (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	recipient TEXT NOT NULL,
+	message_id TEXT NOT NULL,
+	data BLOB NOT NULL,
+	recipients TEXT NOT NULL,
+	headers TEXT NOT NULL,
+	timestamp INTEGER NOT NULL,
+	expires_at INTEGER NOT NULL,
+	stored_at INTEGER NOT NULL
+)`, s.table))
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.ExecContext(ctx, fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %[1]s_recipient ON %[1]s (recipient, id)`,
+		s.table))
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Put inserts the message, and drops the expired and the exceeding messages of the recipient.
+func (s *SQLiteStore) Put(ctx context.Context, to string, m *raindrop.RawMessage) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	recipients, headers, err := sqlutil.MarshalAttributes(m)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s
+		(recipient, message_id, data, recipients, headers, timestamp, expires_at, stored_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, s.table),
+		to, m.ID, m.Data, recipients, headers, m.Timestamp.UnixNano(), sqlutil.UnixNano(m.ExpiresAt), now.UnixMilli())
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(
+		`DELETE FROM %[1]s WHERE recipient = ? AND (stored_at < ? OR id NOT IN (
+			SELECT id FROM %[1]s WHERE recipient = ? ORDER BY id DESC LIMIT ?))`, s.table),
+		to, now.Add(-s.ttl).UnixMilli(), to, s.maxMessages)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) List(ctx context.Context, to string, limit int) ([]*raindrop.OfflineMessage, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(
+		`SELECT id, message_id, data, recipients, headers, timestamp, expires_at, stored_at FROM %s
+		WHERE recipient = ? AND stored_at >= ? ORDER BY id LIMIT ?`, s.table),
+		to, time.Now().Add(-s.ttl).UnixMilli(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []*raindrop.OfflineMessage
+	for rows.Next() {
+		var (
+			id                             int64
+			recipients, headers            []byte
+			timestamp, expiresAt, storedAt int64
+			m                              = new(raindrop.OfflineMessage)
+		)
+		err := rows.Scan(&id, &m.Message.ID, &m.Message.Data, &recipients, &headers, &timestamp, &expiresAt, &storedAt)
+		if err != nil {
+			return nil, err
+		}
+		if err := sqlutil.UnmarshalAttributes(&m.Message, recipients, headers); err != nil {
+			return nil, err
+		}
+		m.ID = strconv.FormatInt(id, 10)
+		m.Message.Timestamp = time.Unix(0, timestamp)
+		m.Message.ExpiresAt = sqlutil.FromUnixNano(expiresAt)
+		m.StoredAt = time.UnixMilli(storedAt)
+		list = append(list, m)
+	}
+	return list, rows.Err()
+}
+
+func (s *SQLiteStore) Delete(ctx context.Context, to, id string) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE recipient = ? AND id = ?`, s.table), to, id)
+	return err
+}
+
+// DeleteExpired deletes the expired messages of all the recipients, the expired messages of a recipient are
+// also deleted when a message is put for it.
+func (s *SQLiteStore) DeleteExpired(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE stored_at < ?`, s.table),
+		time.Now().Add(-s.ttl).UnixMilli())
+	return err
+}
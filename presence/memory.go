@@ -0,0 +1,93 @@
+package presence
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryDevice struct {
+	state  State
+	expiry time.Time
+}
+
+// MemoryStore keeps the states of the devices of a node in memory.
+type MemoryStore struct {
+	mu       sync.Mutex
+	devices  map[string]map[string]memoryDevice
+	lastSeen map[string]time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		devices:  make(map[string]map[string]memoryDevice),
+		lastSeen: make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryStore) Set(ctx context.Context, ttl time.Duration, devices ...Device) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, d := range devices {
+		if s.devices[d.User] == nil {
+			s.devices[d.User] = make(map[string]memoryDevice)
+		}
+		s.devices[d.User][d.Name] = memoryDevice{state: d.State, expiry: now.Add(ttl)}
+		s.lastSeen[d.User] = now
+	}
+	return nil
+}
+
+func (s *MemoryStore) Remove(ctx context.Context, user, device string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.devices[user][device]; !ok {
+		return nil
+	}
+	delete(s.devices[user], device)
+	if len(s.devices[user]) == 0 {
+		delete(s.devices, user)
+	}
+	s.lastSeen[user] = time.Now()
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, users ...string) ([]*Presence, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	list := make([]*Presence, 0, len(users))
+	for _, user := range users {
+		devices := make(map[string]State)
+		for name, d := range s.devices[user] {
+			if now.Before(d.expiry) {
+				devices[name] = d.state
+			}
+		}
+		list = append(list, aggregate(user, devices, s.lastSeen[user]))
+	}
+	return list, nil
+}
+
+func (s *MemoryStore) Sweep(ctx context.Context, now time.Time, limit int) ([]Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var swept []Device
+	for user, devices := range s.devices {
+		for name, d := range devices {
+			if len(swept) >= limit {
+				return swept, nil
+			}
+			if now.Before(d.expiry) {
+				continue
+			}
+			delete(devices, name)
+			swept = append(swept, Device{User: user, Name: name, State: d.state})
+		}
+		if len(devices) == 0 {
+			delete(s.devices, user)
+		}
+	}
+	return swept, nil
+}
@@ -0,0 +1,75 @@
+package presence
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// State is the presence state of a device, or of a user by all its devices.
+type State string
+
+const (
+	Online  State = "online"
+	Away    State = "away"
+	Offline State = "offline"
+)
+
+var (
+	ErrInvalidState = errors.New("invalid presence state")
+	ErrTooManyUsers = errors.New("too many users")
+)
+
+// Valid reports whether the state is one of Online, Away and Offline.
+func (s State) Valid() bool {
+	return s == Online || s == Away || s == Offline
+}
+
+// Presence is the presence of a user. The user is Online if any of its devices is online, Away if any of them is
+// away, and Offline otherwise.
+type Presence struct {
+	User  string `json:"user"`
+	State State  `json:"state"`
+	// LastSeen is the last time when a device of the user is seen, it is zero if the user is never seen.
+	LastSeen time.Time        `json:"last_seen"`
+	Devices  map[string]State `json:"devices,omitempty"`
+}
+
+// Device is the state of a device of a user.
+type Device struct {
+	User  string
+	Name  string
+	State State
+}
+
+// Store keeps the states of the devices, e.g. MemoryStore for a single node, or RedisStore for a cluster.
+type Store interface {
+	// Set sets the states of the devices and their last seen, the states expire after the ttl unless they are set
+	// again, so that the devices of a gone node become offline.
+	Set(ctx context.Context, ttl time.Duration, devices ...Device) error
+	// Remove removes the device of the user, and sets its last seen.
+	Remove(ctx context.Context, user, device string) error
+	// Get returns the presences of the users in the same order.
+	Get(ctx context.Context, users ...string) ([]*Presence, error)
+	// Sweep removes at most limit devices which are expired at now, e.g. of a gone node, and returns them. Each
+	// expired device is returned to one caller only.
+	Sweep(ctx context.Context, now time.Time, limit int) ([]Device, error)
+}
+
+// aggregate returns the presence of the user by the states of its devices.
+func aggregate(user string, devices map[string]State, lastSeen time.Time) *Presence {
+	p := &Presence{User: user, State: Offline, LastSeen: lastSeen}
+	if len(devices) > 0 {
+		p.Devices = devices
+	}
+	for _, state := range devices {
+		switch state {
+		case Online:
+			p.State = Online
+			return p
+		case Away:
+			p.State = Away
+		}
+	}
+	return p
+}
@@ -0,0 +1,182 @@
+package presence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore keeps the devices of each user in a redis hash whose values are their states and expiries, the
+// expiries of all the devices in a redis sorted set to sweep them, and the last seen of each user in a redis
+// string, e.g. in the redis of the registry.RedisRegistry. The hash outlives the expiries of its devices by a TTL,
+// so that the expired devices are swept with their states.
+type RedisStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+type RedisStoreOption func(*RedisStore)
+
+func WithPrefix(prefix string) RedisStoreOption {
+	return func(s *RedisStore) {
+		s.prefix = prefix
+	}
+}
+
+func NewRedisStore(client redis.UniversalClient, options ...RedisStoreOption) *RedisStore {
+	s := &RedisStore{
+		client: client,
+		prefix: "RAINDROP_PRESENCE:",
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+func (s *RedisStore) Set(ctx context.Context, ttl time.Duration, devices ...Device) error {
+	if len(devices) == 0 {
+		return nil
+	}
+	now := time.Now()
+	ms := now.Add(ttl).UnixMilli()
+	expiry := strconv.FormatInt(ms, 10)
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, d := range devices {
+			pipe.HSet(ctx, s.devicesKey(d.User), d.Name, string(d.State)+":"+expiry)
+			pipe.PExpire(ctx, s.devicesKey(d.User), 2*ttl)
+			pipe.ZAdd(ctx, s.expiriesKey(), redis.Z{Score: float64(ms), Member: expiryMember(d.User, d.Name)})
+			pipe.Set(ctx, s.lastSeenKey(d.User), now.UnixMilli(), 0)
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *RedisStore) Remove(ctx context.Context, user, device string) error {
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HDel(ctx, s.devicesKey(user), device)
+		pipe.ZRem(ctx, s.expiriesKey(), expiryMember(user, device))
+		pipe.Set(ctx, s.lastSeenKey(user), time.Now().UnixMilli(), 0)
+		return nil
+	})
+	return err
+}
+
+func (s *RedisStore) Get(ctx context.Context, users ...string) ([]*Presence, error) {
+	devices := make([]*redis.MapStringStringCmd, len(users))
+	lastSeen := make([]*redis.StringCmd, len(users))
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, user := range users {
+			devices[i] = pipe.HGetAll(ctx, s.devicesKey(user))
+			lastSeen[i] = pipe.Get(ctx, s.lastSeenKey(user))
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	now := time.Now().UnixMilli()
+	list := make([]*Presence, 0, len(users))
+	for i, user := range users {
+		states := make(map[string]State)
+		for name, val := range devices[i].Val() {
+			state, expiry, ok := strings.Cut(val, ":")
+			if !ok {
+				continue
+			}
+			if ms, err := strconv.ParseInt(expiry, 10, 64); err == nil && ms > now {
+				states[name] = State(state)
+			}
+		}
+		var seen time.Time
+		if ms, err := lastSeen[i].Int64(); err == nil {
+			seen = time.UnixMilli(ms)
+		}
+		list = append(list, aggregate(user, states, seen))
+	}
+	return list, nil
+}
+
+var (
+	// claimScript removes the member from the sorted set of the expiries if it is still expired.
+	claimScript = redis.NewScript(`
+local expiry = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not expiry or tonumber(expiry) > tonumber(ARGV[2]) then
+	return 0
+end
+return redis.call('ZREM', KEYS[1], ARGV[1])`)
+
+	// sweepScript removes the device if it is expired, and returns its state.
+	sweepScript = redis.NewScript(`
+local val = redis.call('HGET', KEYS[1], ARGV[1])
+if not val then
+	return false
+end
+local state, expiry = string.match(val, '^(.*):(%d+)$')
+if not expiry or tonumber(expiry) > tonumber(ARGV[2]) then
+	return false
+end
+redis.call('HDEL', KEYS[1], ARGV[1])
+return state`)
+)
+
+// Sweep claims the expired devices by removing them from the sorted set of the expiries, and removes the claimed
+// ones from their hashes unless they are set again.
+func (s *RedisStore) Sweep(ctx context.Context, now time.Time, limit int) ([]Device, error) {
+	ms := now.UnixMilli()
+	members, err := s.client.ZRangeArgs(ctx, redis.ZRangeArgs{
+		Key:     s.expiriesKey(),
+		Start:   "-inf",
+		Stop:    strconv.FormatInt(ms, 10),
+		ByScore: true,
+		Count:   int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	var swept []Device
+	for _, member := range members {
+		claimed, err := claimScript.Run(ctx, s.client, []string{s.expiriesKey()}, member, ms).Int()
+		if err != nil {
+			return swept, err
+		}
+		var d Device
+		if claimed == 0 || json.Unmarshal([]byte(member), &[]*string{&d.User, &d.Name}) != nil {
+			continue
+		}
+		state, err := sweepScript.Run(ctx, s.client, []string{s.devicesKey(d.User)}, d.Name, ms).Text()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return swept, err
+		}
+		d.State = State(state)
+		swept = append(swept, d)
+	}
+	return swept, nil
+}
+
+// expiryMember returns the member of the device in the sorted set of the expiries.
+func expiryMember(user, device string) string {
+	member, _ := json.Marshal([]string{user, device})
+	return string(member)
+}
+
+func (s *RedisStore) expiriesKey() string {
+	return s.prefix + "EXPIRIES"
+}
+
+func (s *RedisStore) devicesKey(user string) string {
+	return s.prefix + "DEVICES:" + user
+}
+
+func (s *RedisStore) lastSeenKey(user string) string {
+	return s.prefix + "LAST_SEEN:" + user
+}
@@ -0,0 +1,415 @@
+package presence
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cro4k/raindrop"
+	"github.com/cro4k/raindrop/core"
+	"github.com/cro4k/raindrop/envelope"
+)
+
+const (
+	DefaultTTL      = 30 * time.Second
+	DefaultDebounce = 5 * time.Second
+
+	// TopicPrefix is the prefix of the topics of the presence changes, e.g. "presence.alice".
+	TopicPrefix = "presence."
+	// MethodQuery is the method of the requests which query the presences of the users, see Service.Query.
+	MethodQuery = "presence"
+	// MaxQueryUsers is the max count of the users in a query.
+	MaxQueryUsers = 1000
+
+	sweepBatchSize = 100
+)
+
+// Topic returns the topic of the presence changes of the user.
+func Topic(user string) string {
+	return TopicPrefix + user
+}
+
+// Publisher publishes the presence changes to the subscribers of their topics, e.g. topic.Broker.
+type Publisher interface {
+	Publish(ctx context.Context, topic string, data []byte) error
+}
+
+// Identity returns the user and the device of a session.
+type Identity func(s *core.Session) (user, device string)
+
+// SplitID returns an Identity which splits the id of a session by the separator into the user and the device, e.g.
+// "alice/phone", the id is both of them if it has no separator.
+func SplitID(sep string) Identity {
+	return func(s *core.Session) (string, string) {
+		user, device, ok := strings.Cut(s.ID, sep)
+		if !ok {
+			return s.ID, s.ID
+		}
+		return user, device
+	}
+}
+
+// device is a device of the node, its updates of the store are serialised by op. The session is nil within the
+// debounce, and stored reports whether the device is set in the store, it is guarded by the mutex of the service.
+type device struct {
+	Device
+	session *core.Session
+	timer   *time.Timer
+
+	op     sync.Mutex
+	stored bool
+}
+
+// Service is a core.Interceptor which tracks the presences of the clients of a node. A device is online when its
+// session is opened, and it is removed when its session is closed, unless it is opened again within the debounce,
+// so that a flapping connection is not seen. The clients set their states by the envelopes of envelope.TypePresence.
+//
+// The changes of the presence of a user are published to Topic(user) as the envelopes of envelope.TypePresence,
+// whose payload is the json of the Presence, and the clients query the presences by the requests of MethodQuery.
+// The service should be run to refresh the states of the devices of the node, and to sweep the expired devices,
+// so that the devices of a gone node become offline after the ttl, and their changes are published as well.
+type Service struct {
+	store     Store
+	publisher Publisher
+	identity  Identity
+	ttl       time.Duration
+	debounce  time.Duration
+
+	mu      sync.Mutex
+	devices map[string]*device
+}
+
+type ServiceOption func(*Service)
+
+// WithPublisher sets the publisher of the presence changes, they are not published without a publisher.
+func WithPublisher(p Publisher) ServiceOption {
+	return func(s *Service) {
+		s.publisher = p
+	}
+}
+
+// WithIdentity sets the identity of the sessions, e.g. SplitID("/"), the id of a session is both the user and the
+// device by default.
+func WithIdentity(identity Identity) ServiceOption {
+	return func(s *Service) {
+		s.identity = identity
+	}
+}
+
+// WithTTL sets how long the states of the devices of the node are kept without being refreshed.
+func WithTTL(ttl time.Duration) ServiceOption {
+	return func(s *Service) {
+		s.ttl = ttl
+	}
+}
+
+// WithDebounce sets how long a device is kept after its session is closed.
+func WithDebounce(debounce time.Duration) ServiceOption {
+	return func(s *Service) {
+		s.debounce = debounce
+	}
+}
+
+func NewService(store Store, options ...ServiceOption) *Service {
+	s := &Service{
+		store:    store,
+		identity: func(s *core.Session) (string, string) { return s.ID, s.ID },
+		ttl:      DefaultTTL,
+		debounce: DefaultDebounce,
+		devices:  make(map[string]*device),
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// Get returns the presences of the users in the same order.
+func (s *Service) Get(ctx context.Context, users ...string) ([]*Presence, error) {
+	return s.store.Get(ctx, users...)
+}
+
+// SetState sets the state of the device of the client of the node.
+func (s *Service) SetState(ctx context.Context, id string, state State) error {
+	if !state.Valid() {
+		return ErrInvalidState
+	}
+	s.mu.Lock()
+	d, ok := s.devices[id]
+	s.mu.Unlock()
+	if !ok {
+		return core.ErrClientConnectionNotFound
+	}
+	d.op.Lock()
+	defer d.op.Unlock()
+	s.mu.Lock()
+	if d.session == nil || !d.stored {
+		s.mu.Unlock()
+		return core.ErrClientConnectionNotFound
+	}
+	d.State = state
+	dev := d.Device
+	s.mu.Unlock()
+	return s.change(ctx, dev.User, func() error {
+		return s.store.Set(ctx, s.ttl, dev)
+	})
+}
+
+// Query is a core.Handler of MethodQuery, the payload is the json of the users, and the answer is the json of
+// their presences.
+func (s *Service) Query(ctx context.Context, id string, payload []byte) ([]byte, error) {
+	var users []string
+	if err := json.Unmarshal(payload, &users); err != nil {
+		return nil, err
+	}
+	if len(users) > MaxQueryUsers {
+		return nil, ErrTooManyUsers
+	}
+	list, err := s.store.Get(ctx, users...)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(list)
+}
+
+// Run refreshes the states of the devices of the node, and sweeps the expired devices, until the context is done.
+func (s *Service) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		s.refresh(ctx)
+		s.sweep(ctx)
+	}
+}
+
+// refresh sets the states of the connected devices of the node again, and stores the ones which failed to be
+// stored when their sessions are opened.
+func (s *Service) refresh(ctx context.Context) {
+	type pending struct {
+		d    *device
+		sess *core.Session
+	}
+	var unstored []pending
+	s.mu.Lock()
+	devices := make([]Device, 0, len(s.devices))
+	for _, d := range s.devices {
+		switch {
+		case d.session == nil:
+		case d.stored:
+			devices = append(devices, d.Device)
+		default:
+			unstored = append(unstored, pending{d: d, sess: d.session})
+		}
+	}
+	s.mu.Unlock()
+	if err := s.store.Set(ctx, s.ttl, devices...); err != nil && ctx.Err() == nil {
+		slog.ErrorContext(ctx, "refresh presences failed", slog.String("error", err.Error()))
+	}
+	for _, p := range unstored {
+		s.online(ctx, p.d, p.sess)
+	}
+}
+
+// sweep removes the expired devices, and publishes the presences of their users if their states are changed.
+func (s *Service) sweep(ctx context.Context) {
+	for {
+		swept, err := s.store.Sweep(ctx, time.Now(), sweepBatchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.ErrorContext(ctx, "sweep presences failed", slog.String("error", err.Error()))
+			}
+			return
+		}
+		users := make(map[string]map[string]State)
+		for _, d := range swept {
+			if users[d.User] == nil {
+				users[d.User] = make(map[string]State)
+			}
+			users[d.User][d.Name] = d.State
+		}
+		for user, devices := range users {
+			if err := s.publishSwept(ctx, user, devices); err != nil {
+				slog.ErrorContext(ctx, "publish swept presence failed", slog.String("user", user),
+					slog.String("error", err.Error()))
+			}
+		}
+		if len(swept) < sweepBatchSize {
+			return
+		}
+	}
+}
+
+// publishSwept publishes the presence of the user if the swept devices change its state.
+func (s *Service) publishSwept(ctx context.Context, user string, swept map[string]State) error {
+	list, err := s.store.Get(ctx, user)
+	if err != nil {
+		return err
+	}
+	after := list[0]
+	devices := make(map[string]State, len(after.Devices)+len(swept))
+	maps.Copy(devices, swept)
+	maps.Copy(devices, after.Devices)
+	if aggregate(user, devices, after.LastSeen).State == after.State {
+		return nil
+	}
+	return s.publish(ctx, after)
+}
+
+// change applies the change to the store, and publishes the presence of the user if its state is changed.
+func (s *Service) change(ctx context.Context, user string, apply func() error) error {
+	before, err := s.store.Get(ctx, user)
+	if err != nil {
+		return err
+	}
+	if err := apply(); err != nil {
+		return err
+	}
+	after, err := s.store.Get(ctx, user)
+	if err != nil {
+		return err
+	}
+	if before[0].State == after[0].State {
+		return nil
+	}
+	return s.publish(ctx, after[0])
+}
+
+func (s *Service) publish(ctx context.Context, p *Presence) error {
+	if s.publisher == nil {
+		return nil
+	}
+	e := envelope.New(envelope.TypePresence, nil)
+	e.SetHeader(envelope.HeaderPresence, string(p.State))
+	if err := raindrop.MarshalPayload(e, raindrop.JSONCodec{}, p); err != nil {
+		return err
+	}
+	data, err := envelope.Encode(e, envelope.FormatBinary)
+	if err != nil {
+		return err
+	}
+	return s.publisher.Publish(ctx, Topic(p.User), data)
+}
+
+func (s *Service) Outbound(ctx context.Context, sess *core.Session, data []byte) ([]byte, error) {
+	return data, nil
+}
+
+func (s *Service) Inbound(ctx context.Context, sess *core.Session, data []byte) ([]byte, error) {
+	e, format, err := envelope.Decode(data)
+	if err != nil || e.GetType() != envelope.TypePresence {
+		return data, nil
+	}
+	err = s.SetState(ctx, sess.ID, State(e.Header(envelope.HeaderPresence)))
+	res := &envelope.Envelope{Type: envelope.TypeAck, CorrelationId: e.GetId(), Timestamp: time.Now().UnixMilli()}
+	if err != nil {
+		res.Type = envelope.TypeError
+		res.SetHeader(envelope.HeaderError, err.Error())
+	}
+	res.SetHeader(envelope.HeaderPresence, e.Header(envelope.HeaderPresence))
+	if data, err = envelope.Encode(res, format); err == nil {
+		err = sess.Write(ctx, data)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "answer presence failed", slog.String("id", sess.ID), slog.String("error", err.Error()))
+	}
+	return nil, nil
+}
+
+// SessionOpened sets the device of the session online, or keeps its state if it is opened again within the debounce.
+func (s *Service) SessionOpened(ctx context.Context, sess *core.Session) {
+	s.mu.Lock()
+	d, ok := s.devices[sess.ID]
+	if ok {
+		d.session = sess
+		if d.timer != nil {
+			d.timer.Stop()
+			d.timer = nil
+		}
+	} else {
+		user, name := s.identity(sess)
+		d = &device{Device: Device{User: user, Name: name}, session: sess}
+		s.devices[sess.ID] = d
+	}
+	s.mu.Unlock()
+
+	s.online(ctx, d, sess)
+}
+
+// online stores the device of the session as online, unless it is stored or its session is replaced.
+func (s *Service) online(ctx context.Context, d *device, sess *core.Session) {
+	d.op.Lock()
+	defer d.op.Unlock()
+	s.mu.Lock()
+	if d.stored || d.session != sess {
+		s.mu.Unlock()
+		return
+	}
+	d.State = Online
+	dev := d.Device
+	s.mu.Unlock()
+	err := s.change(ctx, dev.User, func() error {
+		return s.store.Set(ctx, s.ttl, dev)
+	})
+	s.log(ctx, dev, err)
+	if err == nil {
+		s.mu.Lock()
+		d.stored = true
+		s.mu.Unlock()
+	}
+}
+
+// SessionClosed removes the device of the session after the debounce.
+func (s *Service) SessionClosed(ctx context.Context, sess *core.Session) {
+	ctx = context.WithoutCancel(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.devices[sess.ID]
+	if !ok || d.session != sess {
+		return
+	}
+	d.session = nil
+	d.timer = time.AfterFunc(s.debounce, func() {
+		s.remove(ctx, sess.ID, d)
+	})
+}
+
+// remove removes the device unless its session is opened again. The device is kept by the node until it is removed
+// from the store, so that a session opened meanwhile sets it again after.
+func (s *Service) remove(ctx context.Context, id string, d *device) {
+	d.op.Lock()
+	defer d.op.Unlock()
+	s.mu.Lock()
+	if s.devices[id] != d || d.session != nil {
+		s.mu.Unlock()
+		return
+	}
+	stored := d.stored
+	d.stored = false
+	s.mu.Unlock()
+	if stored {
+		s.log(ctx, d.Device, s.change(ctx, d.User, func() error {
+			return s.store.Remove(ctx, d.User, d.Name)
+		}))
+	}
+	s.mu.Lock()
+	if s.devices[id] == d && d.session == nil {
+		delete(s.devices, id)
+	}
+	s.mu.Unlock()
+}
+
+func (s *Service) log(ctx context.Context, d Device, err error) {
+	if err != nil {
+		slog.ErrorContext(ctx, "update presence failed", slog.String("user", d.User), slog.String("device", d.Name),
+			slog.String("error", err.Error()))
+	}
+}
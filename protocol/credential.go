@@ -0,0 +1,159 @@
+package protocol
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/cro4k/raindrop/auth"
+)
+
+const (
+	// ControlReauth is sent by the client to extend the session with a new token.
+	ControlReauth = "reauth"
+	// ControlReauthOK is the answer of a successful re-authentication.
+	ControlReauthOK = "reauth_ok"
+	// ControlReauthFailed is the answer of a rejected re-authentication, the session is kept until it is expired.
+	ControlReauthFailed = "reauth_failed"
+	// ControlAuthExpiring warns the client that the credential is about to expire.
+	ControlAuthExpiring = "auth_expiring"
+)
+
+// ControlFrame is a json object carried by a websocket text frame, it is handled by the listener,
+// and never reaches the message handlers. The messages should be sent as binary frames.
+//
+//	{"type":"reauth","token":"<token>"}
+type ControlFrame struct {
+	Type      string     `json:"type"`
+	Token     string     `json:"token,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+var errReauthNotSupported = errors.New("re-authentication is not supported")
+
+// credential tracks the expiry of the identity which admitted the connection.
+type credential struct {
+	mu       sync.Mutex
+	identity *auth.Identity
+
+	authenticator auth.TokenAuthenticator
+	warning       time.Duration
+
+	warnTimer   *time.Timer
+	expireTimer *time.Timer
+
+	onWarn   func(expiresAt time.Time)
+	onExpire func()
+}
+
+func newCredential(identity *auth.Identity, opt *websocketOptions, onWarn func(time.Time), onExpire func()) *credential {
+	c := &credential{
+		identity: identity,
+		warning:  opt.expiryWarning,
+		onWarn:   onWarn,
+		onExpire: onExpire,
+	}
+	// re-authentication is checked by the same authenticator that admitted the connection
+	c.authenticator, _ = opt.authenticator.(auth.TokenAuthenticator)
+	c.schedule()
+	return c
+}
+
+// Identity returns the current identity of the connection.
+func (c *credential) Identity() *auth.Identity {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.identity
+}
+
+func (c *credential) schedule() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopLocked()
+	expiresAt := c.identity.ExpiresAt
+	if expiresAt.IsZero() {
+		return
+	}
+	ttl := time.Until(expiresAt)
+	if c.warning > 0 && ttl > c.warning {
+		c.warnTimer = time.AfterFunc(ttl-c.warning, func() { c.onWarn(expiresAt) })
+	}
+	c.expireTimer = time.AfterFunc(ttl, c.onExpire)
+}
+
+func (c *credential) stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopLocked()
+}
+
+func (c *credential) stopLocked() {
+	if c.warnTimer != nil {
+		c.warnTimer.Stop()
+		c.warnTimer = nil
+	}
+	if c.expireTimer != nil {
+		c.expireTimer.Stop()
+		c.expireTimer = nil
+	}
+}
+
+func (c *credential) reauthenticate(ctx context.Context, token string) (*auth.Identity, error) {
+	if c.authenticator == nil {
+		return nil, errReauthNotSupported
+	}
+	identity, err := c.authenticator.AuthenticateToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if identity.ID != c.Identity().ID {
+		return nil, auth.ErrInvalidCredentials
+	}
+	c.mu.Lock()
+	c.identity = identity
+	c.mu.Unlock()
+	c.schedule()
+	return identity, nil
+}
+
+// handleControl handles the control frame, it reports false if the data is not a control frame.
+func (c *websocketConn) handleControl(ctx context.Context, data []byte) bool {
+	frame := new(ControlFrame)
+	if err := json.Unmarshal(data, frame); err != nil || frame.Type != ControlReauth {
+		return false
+	}
+	identity, err := c.reauthenticate(ctx, frame.Token)
+	if err != nil {
+		_ = c.writeControl(ctx, &ControlFrame{Type: ControlReauthFailed, Error: err.Error()})
+		return true
+	}
+	reply := &ControlFrame{Type: ControlReauthOK}
+	if !identity.ExpiresAt.IsZero() {
+		reply.ExpiresAt = &identity.ExpiresAt
+	}
+	_ = c.writeControl(ctx, reply)
+	return true
+}
+
+func (c *websocketConn) writeControl(ctx context.Context, frame *ControlFrame) error {
+	data, err := json.Marshal(frame)
+	if err != nil {
+		return err
+	}
+	return c.conn.Write(ctx, websocket.MessageText, data)
+}
+
+func (c *websocketConn) warn(expiresAt time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = c.writeControl(ctx, &ControlFrame{Type: ControlAuthExpiring, ExpiresAt: &expiresAt})
+}
+
+// expire closes the underlying connection, the reader fails and the session is closed by the server.
+func (c *websocketConn) expire() {
+	_ = c.conn.Close(websocket.StatusPolicyViolation, "credentials expired")
+}
@@ -0,0 +1,88 @@
+package protocol
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/cro4k/raindrop/core"
+)
+
+// WebsocketEndpoints is a listener of several websocket endpoints, each endpoint is a http.Handler
+// which can be mounted on an existing mux or router, with its own authenticator and options.
+// All the endpoints feed the same core.Server.
+//
+//	endpoints := protocol.NewWebsocketEndpoints()
+//	mux.Handle("/ws/app", endpoints.Endpoint("app", protocol.WithAuthenticator(appAuth)))
+//	mux.Handle("/ws/device", endpoints.Endpoint("device", protocol.WithAuthenticator(deviceAuth)))
+//	srv := core.NewServer(endpoints)
+type WebsocketEndpoints struct {
+	mu      sync.RWMutex
+	handler func(id string, conn core.Conn) error
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func NewWebsocketEndpoints() *WebsocketEndpoints {
+	return &WebsocketEndpoints{closed: make(chan struct{})}
+}
+
+// Endpoint creates a handler of the endpoint, the sessions of the endpoint have the transport `websocket/<name>`.
+func (e *WebsocketEndpoints) Endpoint(name string, opts ...WebsocketOption) http.Handler {
+	return &websocketEndpoint{
+		websocketOptions: applyWebsocketOptions(nil, opts...),
+		transport:        "websocket/" + name,
+		endpoints:        e,
+	}
+}
+
+// Serve accepts the connections of all endpoints until the context is done or the listener is closed.
+func (e *WebsocketEndpoints) Serve(ctx context.Context, h func(id string, conn core.Conn) error) error {
+	e.setHandler(h)
+	defer e.setHandler(nil)
+
+	select {
+	case <-ctx.Done():
+	case <-e.closed:
+	}
+	return nil
+}
+
+func (e *WebsocketEndpoints) Close() error {
+	e.closeOnce.Do(func() {
+		close(e.closed)
+	})
+	return nil
+}
+
+func (e *WebsocketEndpoints) Transport() string {
+	return "websocket"
+}
+
+func (e *WebsocketEndpoints) setHandler(h func(id string, conn core.Conn) error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.handler = h
+}
+
+func (e *WebsocketEndpoints) getHandler() func(id string, conn core.Conn) error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.handler
+}
+
+type websocketEndpoint struct {
+	*websocketOptions
+	transport string
+	endpoints *WebsocketEndpoints
+}
+
+func (ep *websocketEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handler := ep.endpoints.getHandler()
+	if handler == nil {
+		http.Error(w, "server is not serving", http.StatusServiceUnavailable)
+		return
+	}
+	serveWebsocket(w, r, ep.websocketOptions, ep.transport, handler)
+}
@@ -4,20 +4,35 @@ import (
 	"context"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/coder/websocket"
+	"github.com/cro4k/raindrop/auth"
 	"github.com/cro4k/raindrop/core"
 )
 
 type websocketConn struct {
-	id   string
-	conn *websocket.Conn
-	done chan struct{}
+	id        string
+	transport string
+	params    url.Values
+	conn      *websocket.Conn
+	done      chan struct{}
+
+	*credential
 }
 
 func (c *websocketConn) Read(ctx context.Context) ([]byte, error) {
-	_, data, err := c.conn.Read(ctx)
-	return data, err
+	for {
+		typ, data, err := c.conn.Read(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if typ == websocket.MessageText && c.handleControl(ctx, data) {
+			continue
+		}
+		return data, nil
+	}
 }
 
 func (c *websocketConn) Write(ctx context.Context, data []byte) error {
@@ -25,6 +40,7 @@ func (c *websocketConn) Write(ctx context.Context, data []byte) error {
 }
 
 func (c *websocketConn) Close() error {
+	c.stop()
 	close(c.done)
 	return c.conn.Close(websocket.StatusInternalError, "")
 }
@@ -33,19 +49,92 @@ func (c *websocketConn) Done() <-chan struct{} {
 	return c.done
 }
 
-func newWebsocketConn(id string, conn *websocket.Conn) *websocketConn {
-	return &websocketConn{id: id, conn: conn, done: make(chan struct{})}
+func (c *websocketConn) Transport() string {
+	return c.transport
+}
+
+func (c *websocketConn) Subprotocol() string {
+	return c.conn.Subprotocol()
+}
+
+func (c *websocketConn) Params() url.Values {
+	return c.params
+}
+
+func newWebsocketConn(identity *auth.Identity, conn *websocket.Conn, opt *websocketOptions, transport string) *websocketConn {
+	c := &websocketConn{id: identity.ID, transport: transport, conn: conn, done: make(chan struct{})}
+	c.credential = newCredential(identity, opt, c.warn, c.expire)
+	return c
+}
+
+type websocketOptions struct {
+	authenticator auth.Authenticator
+	subprotocols  []string
+	expiryWarning time.Duration
+	readLimit     int64
+}
+
+type WebsocketOption func(*websocketOptions)
+
+// WithAuthenticator replaces the auth function of the listener.
+func WithAuthenticator(a auth.Authenticator) WebsocketOption {
+	return func(o *websocketOptions) {
+		o.authenticator = a
+	}
+}
+
+// WithSubprotocols sets the subprotocols the listener accepts in the handshake,
+// e.g. auth.DefaultSubprotocol when the browsers pass the token by the Sec-WebSocket-Protocol header.
+func WithSubprotocols(subprotocols ...string) WebsocketOption {
+	return func(o *websocketOptions) {
+		o.subprotocols = subprotocols
+	}
+}
+
+// WithExpiryWarning sends an `auth_expiring` control frame the duration before the credential is expired,
+// so that the client has a chance to re-authenticate in-band. See ControlFrame.
+func WithExpiryWarning(before time.Duration) WebsocketOption {
+	return func(o *websocketOptions) {
+		o.expiryWarning = before
+	}
+}
+
+// WithReadLimit sets the max size of the frames read from the clients, it is 32 KiB by default.
+// The larger messages should be fragmented, see the fragment package.
+func WithReadLimit(limit int64) WebsocketOption {
+	return func(o *websocketOptions) {
+		o.readLimit = limit
+	}
+}
+
+func applyWebsocketOptions(authFunc func(r *http.Request) (string, error), opts ...WebsocketOption) *websocketOptions {
+	o := &websocketOptions{}
+	if authFunc != nil {
+		o.authenticator = auth.FromFunc(authFunc)
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.authenticator == nil {
+		o.authenticator = auth.AuthenticatorFunc(func(r *http.Request) (*auth.Identity, error) {
+			return nil, auth.ErrNoCredentials
+		})
+	}
+	return o
 }
 
 type WebsocketListener struct {
-	auth    func(r *http.Request) (string, error)
+	*websocketOptions
 	handler func(id string, conn core.Conn) error
 }
 
-func NewWebsocketListener(auth func(r *http.Request) (string, error)) *WebsocketListener {
-	return &WebsocketListener{auth: auth, handler: func(id string, conn core.Conn) error {
-		return conn.Close()
-	}}
+func NewWebsocketListener(authFunc func(r *http.Request) (string, error), opts ...WebsocketOption) *WebsocketListener {
+	return &WebsocketListener{
+		websocketOptions: applyWebsocketOptions(authFunc, opts...),
+		handler: func(id string, conn core.Conn) error {
+			return conn.Close()
+		},
+	}
 }
 
 func (wl *WebsocketListener) Serve(ctx context.Context, h func(id string, conn core.Conn) error) error {
@@ -57,19 +146,32 @@ func (wl *WebsocketListener) Close() error {
 	return nil
 }
 
+func (wl *WebsocketListener) Transport() string {
+	return "websocket"
+}
+
 func (wl *WebsocketListener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	id, err := wl.auth(r)
+	serveWebsocket(w, r, wl.websocketOptions, wl.Transport(), wl.handler)
+}
+
+func serveWebsocket(w http.ResponseWriter, r *http.Request, opt *websocketOptions, transport string,
+	handler func(id string, conn core.Conn) error) {
+	identity, err := opt.authenticator.Authenticate(r)
 	if err != nil {
 		http.Error(w, "auth error", http.StatusUnauthorized)
 		return
 	}
-	c, err := websocket.Accept(w, r, nil)
+	c, err := websocket.Accept(w, r, &websocket.AcceptOptions{Subprotocols: opt.subprotocols})
 	if err != nil {
 		http.Error(w, "accept error", http.StatusBadRequest)
 		return
 	}
-	cc := newWebsocketConn(id, c)
-	if err := wl.handler(id, cc); err != nil {
+	if opt.readLimit > 0 {
+		c.SetReadLimit(opt.readLimit)
+	}
+	cc := newWebsocketConn(identity, c, opt, transport)
+	cc.params = r.URL.Query()
+	if err := handler(identity.ID, cc); err != nil {
 		// TODO
 		return
 	}
@@ -77,15 +179,15 @@ func (wl *WebsocketListener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 type WebsocketServer struct {
-	auth func(r *http.Request) (string, error)
+	*websocketOptions
 
 	srv *http.Server
 }
 
 func (ws *WebsocketServer) Serve(ctx context.Context, h func(id string, conn core.Conn) error) error {
 	ws.srv.Handler = &WebsocketListener{
-		auth:    ws.auth,
-		handler: h,
+		websocketOptions: ws.websocketOptions,
+		handler:          h,
 	}
 	slog.InfoContext(ctx, "websocket server is listening on"+ws.srv.Addr)
 	return ws.srv.ListenAndServe()
@@ -95,9 +197,13 @@ func (ws *WebsocketServer) Close() error {
 	return ws.srv.Shutdown(context.Background())
 }
 
-func NewWebsocketServer(addr string, auth func(r *http.Request) (string, error)) *WebsocketServer {
+func (ws *WebsocketServer) Transport() string {
+	return "websocket"
+}
+
+func NewWebsocketServer(addr string, authFunc func(r *http.Request) (string, error), opts ...WebsocketOption) *WebsocketServer {
 	return &WebsocketServer{
-		auth: auth,
+		websocketOptions: applyWebsocketOptions(authFunc, opts...),
 		srv: &http.Server{
 			Addr: addr,
 		},
@@ -2,13 +2,16 @@ package raindrop
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"sync/atomic"
 	"time"
 
+	"github.com/cro4k/raindrop/envelope"
 	"golang.org/x/sync/errgroup"
 )
 
+const DefaultDeliveryConcurrency = 64
+
 type Server interface {
 	WriteTo(ctx context.Context, to string, data []byte) error
 	Start(ctx context.Context) error
@@ -20,6 +23,25 @@ type Raindrop struct {
 	sub      MessageSubscriber
 	resolver MessageResolver
 	server   Server
+	codec    Codec
+
+	deadLetters DeadLetterSink
+	retryPolicy *RetryPolicy
+	retries     *delayQueue
+	offline     OfflineStore
+
+	delays       DelayStore
+	pollInterval time.Duration
+
+	ttl     time.Duration
+	expired atomic.Uint64
+
+	dedupe     Deduplicator
+	duplicates atomic.Uint64
+
+	topics TopicPublisher
+
+	concurrency int
 }
 
 type Option interface {
@@ -76,30 +98,96 @@ func WithServer(server Server) OptionFunc {
 	}
 }
 
+// WithDeliveryConcurrency sets how many destinations of a message are written at the same time, it is
+// DefaultDeliveryConcurrency by default, and it is 1 to write them one by one.
+func WithDeliveryConcurrency(concurrency int) OptionFunc {
+	return func(r *Raindrop) {
+		r.concurrency = max(concurrency, 1)
+	}
+}
+
+// WithCodec sets the codec of SendValue, it is JSONCodec by default.
+func WithCodec(codec Codec) OptionFunc {
+	return func(r *Raindrop) {
+		r.codec = codec
+	}
+}
+
 func NewRaindrop(options ...Option) *Raindrop {
-	raindrop := &Raindrop{}
+	raindrop := &Raindrop{codec: JSONCodec{}, concurrency: DefaultDeliveryConcurrency}
 	applyOptions(raindrop, options...)
 	return raindrop
 }
 
 func (r *Raindrop) serve(ctx context.Context) error {
 	return r.sub.Subscribe(ctx, func(ctx context.Context, m *RawMessage) error {
-		destinations, err := r.resolver.Resolve(ctx, m)
-		if err != nil {
+		if m.Expired(time.Now()) {
+			r.expire(ctx, m, nil, 0)
 			return nil
 		}
-		for _, dst := range destinations {
-			err = errors.Join(err, r.server.WriteTo(ctx, dst, m.Data))
+		key, duplicate := r.claim(ctx, m)
+		if duplicate {
+			return nil
 		}
+		stop := r.extend(ctx, key)
+		delivered, err := r.handle(ctx, m)
+		stop()
+		r.settle(ctx, key, delivered)
 		return err
 	})
 }
 
+// handle publishes the message to its topic, or delivers it to its destinations. It reports whether the message is
+// delivered, the failed destinations are owned by the retry, offline and dead-letter paths then.
+func (r *Raindrop) handle(ctx context.Context, m *RawMessage) (bool, error) {
+	if topic := m.Header(HeaderTopic); topic != "" && r.topics != nil {
+		return r.publishTopic(ctx, m, topic), nil
+	}
+	destinations, err := r.resolver.Resolve(ctx, m)
+	if err != nil {
+		r.deadLetter(ctx, m, err, nil, 1)
+		return false, nil
+	}
+	return true, r.deliver(ctx, m, destinations, 1)
+}
+
 func (r *Raindrop) Send(ctx context.Context, id string, data []byte) error {
+	return r.SendMessage(ctx, &RawMessage{ID: id, Data: data})
+}
+
+// SendMessage publishes the message, e.g. with its recipients and headers. The timestamp and the expiry are set
+// if they are zero.
+func (r *Raindrop) SendMessage(ctx context.Context, m *RawMessage) error {
 	if r.pub == nil {
 		return fmt.Errorf("message publisher is not set")
 	}
-	return r.pub.Publish(ctx, &RawMessage{ID: id, Data: data, Timestamp: time.Now()})
+	if m.Timestamp.IsZero() {
+		m.Timestamp = time.Now()
+	}
+	if m.ExpiresAt.IsZero() {
+		m.ExpiresAt = r.expiry(ctx, m.Timestamp)
+	}
+	return r.pub.Publish(ctx, m)
+}
+
+// SendEnvelope publishes the envelope in binary format, the id of the message is the id of the envelope.
+func (r *Raindrop) SendEnvelope(ctx context.Context, e *envelope.Envelope) error {
+	data, err := envelope.Encode(e, envelope.FormatBinary)
+	if err != nil {
+		return err
+	}
+	return r.Send(ctx, e.GetId(), data)
+}
+
+// SendValue encodes the value by the codec of the Raindrop, and publishes it in an envelope. The payload is
+// transcoded to the codec of each session by the Transcoder.
+func (r *Raindrop) SendValue(ctx context.Context, id string, v any) error {
+	e := envelope.New(envelope.TypeMessage, nil)
+	e.Id = id
+	if err := MarshalPayload(e, r.codec, v); err != nil {
+		return err
+	}
+	return r.SendEnvelope(ctx, e)
 }
 
 func (r *Raindrop) Start(ctx context.Context) error {
@@ -111,6 +199,24 @@ func (r *Raindrop) Start(ctx context.Context) error {
 		})
 	}
 
+	if r.retries != nil {
+		group.Go(func() error {
+			return r.serveRetries(ctx)
+		})
+	}
+
+	if r.delays != nil && r.pub != nil {
+		group.Go(func() error {
+			return r.serveSchedules(ctx)
+		})
+	}
+
+	if runner, ok := r.topics.(runner); ok {
+		group.Go(func() error {
+			return runner.Run(ctx)
+		})
+	}
+
 	group.Go(func() error {
 		return r.server.Start(ctx)
 	})
@@ -2,6 +2,8 @@ package registry
 
 import (
 	"context"
+	"errors"
+	"io"
 
 	"github.com/cro4k/raindrop/core"
 	"github.com/cro4k/raindrop/registry/connector"
@@ -11,7 +13,14 @@ import (
 )
 
 const (
+	// ChunkSize is the size of the chunks of SendStream, the larger messages are sent in chunks so that they are
+	// not limited by the max message size of grpc.
+	ChunkSize = 1 << 20
+
 	StatusCodeClientConnectionNotFound codes.Code = 10001
+	StatusCodeClientDisconnected       codes.Code = 10002
+	StatusCodeCallFailed               codes.Code = 10003
+	StatusCodeMessageExpired           codes.Code = 10004
 )
 
 type Client struct {
@@ -20,16 +29,96 @@ type Client struct {
 }
 
 func (c *Client) WriteTo(ctx context.Context, to string, data []byte) error {
-	_, err := c.c.SendMessage(ctx, &connector.SendMessageRequest{To: to, Data: data})
+	return c.WriteToChannel(ctx, to, "", data)
+}
+
+func (c *Client) WriteToChannel(ctx context.Context, to, channel string, data []byte) error {
+	var err error
+	if len(data) > ChunkSize {
+		err = c.sendStream(ctx, &connector.SendChunk{To: to, Channel: channel, ExpiresAt: expiresAt(ctx)}, data)
+	} else {
+		_, err = c.c.SendMessage(ctx, &connector.SendMessageRequest{
+			To:        to,
+			Data:      data,
+			Channel:   channel,
+			ExpiresAt: expiresAt(ctx),
+		})
+	}
 	if err == nil {
 		return nil
 	}
-	if st, ok := status.FromError(err); ok && st.Code() == StatusCodeClientConnectionNotFound {
-		return core.ErrClientConnectionNotFound
+	if st, ok := status.FromError(err); ok {
+		switch st.Code() {
+		case StatusCodeClientConnectionNotFound:
+			return core.ErrClientConnectionNotFound
+		case StatusCodeMessageExpired:
+			return core.ErrMessageExpired
+		}
+	}
+	return err
+}
+
+// sendStream sends the data in chunks, the first chunk is the head which names the recipient or the topic.
+func (c *Client) sendStream(ctx context.Context, head *connector.SendChunk, data []byte) error {
+	stream, err := c.c.SendStream(ctx)
+	if err != nil {
+		return err
+	}
+	for offset := 0; offset < len(data); offset += ChunkSize {
+		chunk := &connector.SendChunk{}
+		if offset == 0 {
+			chunk = head
+		}
+		chunk.Data = data[offset:min(offset+ChunkSize, len(data))]
+		if err := stream.Send(chunk); err != nil {
+			if errors.Is(err, io.EOF) {
+				// the server has answered, the error is reported by CloseAndRecv
+				break
+			}
+			return err
+		}
+	}
+	_, err = stream.CloseAndRecv()
+	return err
+}
+
+// WriteToTopic writes the data to the clients of the node subscribing to the topic.
+func (c *Client) WriteToTopic(ctx context.Context, topic string, data []byte) error {
+	if len(data) > ChunkSize {
+		return c.sendStream(ctx, &connector.SendChunk{Topic: topic, ExpiresAt: expiresAt(ctx)}, data)
 	}
+	_, err := c.c.Publish(ctx, &connector.PublishRequest{Topic: topic, Data: data, ExpiresAt: expiresAt(ctx)})
 	return err
 }
 
+// expiresAt returns the expiry of the context in unix milliseconds, it is 0 if there is no expiry.
+func expiresAt(ctx context.Context) int64 {
+	if expiry := core.ExpiryFromContext(ctx); !expiry.IsZero() {
+		return expiry.UnixMilli()
+	}
+	return 0
+}
+
+func (c *Client) Call(ctx context.Context, to string, payload []byte) ([]byte, error) {
+	res, err := c.c.Call(ctx, &connector.CallRequest{To: to, Payload: payload})
+	if err == nil {
+		return res.Payload, nil
+	}
+	if st, ok := status.FromError(err); ok {
+		switch st.Code() {
+		case StatusCodeClientConnectionNotFound:
+			return nil, core.ErrClientConnectionNotFound
+		case StatusCodeClientDisconnected:
+			return nil, core.ErrClientDisconnected
+		case StatusCodeCallFailed:
+			return nil, &core.CallError{Message: st.Message()}
+		case codes.DeadlineExceeded:
+			return nil, context.DeadlineExceeded
+		}
+	}
+	return nil, err
+}
+
 func (c *Client) Close() error {
 	return c.cc.Close()
 }
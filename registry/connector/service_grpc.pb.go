@@ -1,7 +1,7 @@
 // Code generated by protoc-gen-go-grpc. DO NOT EDIT.
 // versions:
 // - protoc-gen-go-grpc v1.5.1
-// - protoc             v5.27.1
+// - protoc             (unknown)
 // source: connector/service.proto
 
 package connector
@@ -21,6 +21,9 @@ const _ = grpc.SupportPackageIsVersion9
 const (
 	ConnectorService_SendMessage_FullMethodName = "/ConnectorService/SendMessage"
 	ConnectorService_GetVersion_FullMethodName  = "/ConnectorService/GetVersion"
+	ConnectorService_Call_FullMethodName        = "/ConnectorService/Call"
+	ConnectorService_SendStream_FullMethodName  = "/ConnectorService/SendStream"
+	ConnectorService_Publish_FullMethodName     = "/ConnectorService/Publish"
 )
 
 // ConnectorServiceClient is the client API for ConnectorService service.
@@ -29,6 +32,11 @@ const (
 type ConnectorServiceClient interface {
 	SendMessage(ctx context.Context, in *SendMessageRequest, opts ...grpc.CallOption) (*SendMessageResponse, error)
 	GetVersion(ctx context.Context, in *GetVersionRequest, opts ...grpc.CallOption) (*GetVersionResponse, error)
+	Call(ctx context.Context, in *CallRequest, opts ...grpc.CallOption) (*CallResponse, error)
+	// SendStream sends a message in chunks, the first chunk names the recipient or the topic.
+	SendStream(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[SendChunk, SendMessageResponse], error)
+	// Publish writes a message to the clients of the node subscribing to the topic.
+	Publish(ctx context.Context, in *PublishRequest, opts ...grpc.CallOption) (*SendMessageResponse, error)
 }
 
 type connectorServiceClient struct {
@@ -59,12 +67,50 @@ func (c *connectorServiceClient) GetVersion(ctx context.Context, in *GetVersionR
 	return out, nil
 }
 
+func (c *connectorServiceClient) Call(ctx context.Context, in *CallRequest, opts ...grpc.CallOption) (*CallResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CallResponse)
+	err := c.cc.Invoke(ctx, ConnectorService_Call_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *connectorServiceClient) SendStream(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[SendChunk, SendMessageResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ConnectorService_ServiceDesc.Streams[0], ConnectorService_SendStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SendChunk, SendMessageResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ConnectorService_SendStreamClient = grpc.ClientStreamingClient[SendChunk, SendMessageResponse]
+
+func (c *connectorServiceClient) Publish(ctx context.Context, in *PublishRequest, opts ...grpc.CallOption) (*SendMessageResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SendMessageResponse)
+	err := c.cc.Invoke(ctx, ConnectorService_Publish_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ConnectorServiceServer is the server API for ConnectorService service.
 // All implementations must embed UnimplementedConnectorServiceServer
 // for forward compatibility.
 type ConnectorServiceServer interface {
 	SendMessage(context.Context, *SendMessageRequest) (*SendMessageResponse, error)
 	GetVersion(context.Context, *GetVersionRequest) (*GetVersionResponse, error)
+	Call(context.Context, *CallRequest) (*CallResponse, error)
+	// SendStream sends a message in chunks, the first chunk names the recipient or the topic.
+	SendStream(grpc.ClientStreamingServer[SendChunk, SendMessageResponse]) error
+	// Publish writes a message to the clients of the node subscribing to the topic.
+	Publish(context.Context, *PublishRequest) (*SendMessageResponse, error)
 	mustEmbedUnimplementedConnectorServiceServer()
 }
 
@@ -81,6 +127,15 @@ func (UnimplementedConnectorServiceServer) SendMessage(context.Context, *SendMes
 func (UnimplementedConnectorServiceServer) GetVersion(context.Context, *GetVersionRequest) (*GetVersionResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetVersion not implemented")
 }
+func (UnimplementedConnectorServiceServer) Call(context.Context, *CallRequest) (*CallResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Call not implemented")
+}
+func (UnimplementedConnectorServiceServer) SendStream(grpc.ClientStreamingServer[SendChunk, SendMessageResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method SendStream not implemented")
+}
+func (UnimplementedConnectorServiceServer) Publish(context.Context, *PublishRequest) (*SendMessageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Publish not implemented")
+}
 func (UnimplementedConnectorServiceServer) mustEmbedUnimplementedConnectorServiceServer() {}
 func (UnimplementedConnectorServiceServer) testEmbeddedByValue()                          {}
 
@@ -138,6 +193,49 @@ func _ConnectorService_GetVersion_Handler(srv interface{}, ctx context.Context,
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ConnectorService_Call_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CallRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConnectorServiceServer).Call(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ConnectorService_Call_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConnectorServiceServer).Call(ctx, req.(*CallRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ConnectorService_SendStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ConnectorServiceServer).SendStream(&grpc.GenericServerStream[SendChunk, SendMessageResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ConnectorService_SendStreamServer = grpc.ClientStreamingServer[SendChunk, SendMessageResponse]
+
+func _ConnectorService_Publish_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PublishRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConnectorServiceServer).Publish(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ConnectorService_Publish_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConnectorServiceServer).Publish(ctx, req.(*PublishRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // ConnectorService_ServiceDesc is the grpc.ServiceDesc for ConnectorService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -153,7 +251,21 @@ var ConnectorService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetVersion",
 			Handler:    _ConnectorService_GetVersion_Handler,
 		},
+		{
+			MethodName: "Call",
+			Handler:    _ConnectorService_Call_Handler,
+		},
+		{
+			MethodName: "Publish",
+			Handler:    _ConnectorService_Publish_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SendStream",
+			Handler:       _ConnectorService_SendStream_Handler,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "connector/service.proto",
 }
@@ -18,15 +18,12 @@ type (
 
 	grpcServiceWrapper struct {
 		GRPCRegistryService
-
-		options []grpc.DialOption
-
-		cache sync.Map
+		*NodeDialer
 	}
 )
 
 func FromGRPCRegistryService(s GRPCRegistryService, options ...grpc.DialOption) core.RegistryService {
-	return &grpcServiceWrapper{GRPCRegistryService: s, options: options}
+	return &grpcServiceWrapper{GRPCRegistryService: s, NodeDialer: NewNodeDialer(options...)}
 }
 
 func (s *grpcServiceWrapper) Register(ctx context.Context, id string, host any, cc core.Healthy) error {
@@ -42,8 +39,27 @@ func (s *grpcServiceWrapper) Discover(ctx context.Context, id string) (core.Writ
 	if err != nil {
 		return nil, err
 	}
+	return s.dial(host)
+}
+
+// NodeDialer keeps the connector clients of the nodes by their hosts.
+type NodeDialer struct {
+	options []grpc.DialOption
+
+	cache sync.Map
+}
+
+func NewNodeDialer(options ...grpc.DialOption) *NodeDialer {
+	return &NodeDialer{options: options}
+}
+
+// DiscoverNode returns the client of the node whose host is the node.
+func (d *NodeDialer) DiscoverNode(ctx context.Context, node string) (core.Writer, error) {
+	return d.dial(node)
+}
 
-	val, ok := s.cache.Load(host)
+func (d *NodeDialer) dial(host string) (*Client, error) {
+	val, ok := d.cache.Load(host)
 	if ok {
 		client := val.(*Client)
 		state := client.cc.GetState()
@@ -54,10 +70,10 @@ func (s *grpcServiceWrapper) Discover(ctx context.Context, id string) (core.Writ
 		}
 	}
 
-	c, err := CreateClient(host, s.options...)
+	c, err := CreateClient(host, d.options...)
 	if err != nil {
 		return nil, err
 	}
-	s.cache.Store(host, c)
+	d.cache.Store(host, c)
 	return c, nil
 }
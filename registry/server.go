@@ -6,34 +6,143 @@ import (
 	"io"
 	"log/slog"
 	"net"
+	"time"
 
 	"github.com/cro4k/raindrop/core"
 	"github.com/cro4k/raindrop/registry/connector"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+// DefaultMaxStreamSize is the max size of the messages sent by SendStream.
+const DefaultMaxStreamSize = 64 << 20
+
+var ErrStreamTooLarge = errors.New("stream is too large")
+
 type GRPCRegistryServer struct {
-	w       core.Writer
-	version string
+	w             core.Writer
+	topics        core.TopicWriter
+	version       string
+	maxStreamSize int
 	connector.UnimplementedConnectorServiceServer
 }
 
 func NewGRPCRegistryServer(w core.Writer, version string) *GRPCRegistryServer {
-	return &GRPCRegistryServer{w: w, version: version}
+	return &GRPCRegistryServer{w: w, version: version, maxStreamSize: DefaultMaxStreamSize}
 }
 
-func (s *GRPCRegistryServer) SendMessage(ctx context.Context, req *connector.SendMessageRequest) (*connector.SendMessageResponse, error) {
-	err := s.w.WriteTo(ctx, req.To, req.Data)
-	if errors.Is(err, core.ErrClientConnectionNotFound) {
-		return nil, status.Error(StatusCodeClientConnectionNotFound, err.Error())
+// SetMaxStreamSize sets the max size of the messages sent by SendStream.
+func (s *GRPCRegistryServer) SetMaxStreamSize(size int) {
+	s.maxStreamSize = size
+}
+
+// SetTopicWriter sets the writer of the messages published to the node, e.g. a topic.Broker.
+func (s *GRPCRegistryServer) SetTopicWriter(w core.TopicWriter) {
+	s.topics = w
+}
+
+func (s *GRPCRegistryServer) Publish(ctx context.Context, req *connector.PublishRequest) (*connector.SendMessageResponse, error) {
+	if err := s.writeToTopic(ctx, req.Topic, req.ExpiresAt, req.Data); err != nil {
+		return nil, err
 	}
-	if err != nil {
+	return &connector.SendMessageResponse{}, nil
+}
+
+func (s *GRPCRegistryServer) writeToTopic(ctx context.Context, topic string, expiresAt int64, data []byte) error {
+	if s.topics == nil {
+		return status.Error(codes.Unimplemented, core.ErrTopicsNotSupported.Error())
+	}
+	if expiresAt > 0 {
+		ctx = core.WithExpiry(ctx, time.UnixMilli(expiresAt))
+	}
+	return s.topics.WriteToTopic(ctx, topic, data)
+}
+
+func (s *GRPCRegistryServer) SendMessage(ctx context.Context, req *connector.SendMessageRequest) (*connector.SendMessageResponse, error) {
+	if err := s.writeTo(ctx, req.To, req.Channel, req.ExpiresAt, req.Data); err != nil {
 		return nil, err
 	}
 	return &connector.SendMessageResponse{}, nil
 }
 
+func (s *GRPCRegistryServer) SendStream(stream connector.ConnectorService_SendStreamServer) error {
+	var (
+		head *connector.SendChunk
+		data []byte
+	)
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if head == nil {
+			head = chunk
+		}
+		if len(data)+len(chunk.Data) > s.maxStreamSize {
+			return status.Error(codes.ResourceExhausted, ErrStreamTooLarge.Error())
+		}
+		data = append(data, chunk.Data...)
+	}
+	if head == nil {
+		return status.Error(codes.InvalidArgument, "empty stream")
+	}
+	var err error
+	if head.Topic != "" {
+		err = s.writeToTopic(stream.Context(), head.Topic, head.ExpiresAt, data)
+	} else {
+		err = s.writeTo(stream.Context(), head.To, head.Channel, head.ExpiresAt, data)
+	}
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(&connector.SendMessageResponse{})
+}
+
+func (s *GRPCRegistryServer) writeTo(ctx context.Context, to, channel string, expiresAt int64, data []byte) error {
+	if expiresAt > 0 {
+		ctx = core.WithExpiry(ctx, time.UnixMilli(expiresAt))
+	}
+	var err error
+	if cw, ok := s.w.(core.ChannelWriter); ok && channel != "" {
+		err = cw.WriteToChannel(ctx, to, channel, data)
+	} else {
+		err = s.w.WriteTo(ctx, to, data)
+	}
+	switch {
+	case errors.Is(err, core.ErrClientConnectionNotFound):
+		return status.Error(StatusCodeClientConnectionNotFound, err.Error())
+	case errors.Is(err, core.ErrMessageExpired):
+		return status.Error(StatusCodeMessageExpired, err.Error())
+	}
+	return err
+}
+
+func (s *GRPCRegistryServer) Call(ctx context.Context, req *connector.CallRequest) (*connector.CallResponse, error) {
+	c, ok := s.w.(core.Caller)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, core.ErrCallNotSupported.Error())
+	}
+	payload, err := c.Call(ctx, req.To, req.Payload)
+	var callErr *core.CallError
+	switch {
+	case err == nil:
+		return &connector.CallResponse{Payload: payload}, nil
+	case errors.Is(err, core.ErrClientConnectionNotFound):
+		return nil, status.Error(StatusCodeClientConnectionNotFound, err.Error())
+	case errors.Is(err, core.ErrClientDisconnected):
+		return nil, status.Error(StatusCodeClientDisconnected, err.Error())
+	case errors.As(err, &callErr):
+		return nil, status.Error(StatusCodeCallFailed, callErr.Message)
+	case errors.Is(err, context.DeadlineExceeded):
+		return nil, status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	return nil, err
+}
+
 func (s *GRPCRegistryServer) GetVersion(ctx context.Context, req *connector.GetVersionRequest) (*connector.GetVersionResponse, error) {
 	return &connector.GetVersionResponse{Version: s.version}, nil
 }
@@ -0,0 +1,228 @@
+package raindrop
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/cro4k/raindrop/core"
+	"golang.org/x/sync/errgroup"
+)
+
+var ErrRetryQueueFull = errors.New("retry queue is full")
+
+// RetryPolicy decides how the failed deliveries are retried. The retries wait in a delay queue, so that they
+// do not block the other messages.
+type RetryPolicy struct {
+	// MaxAttempts is the max attempts of each destination, including the first one.
+	MaxAttempts int
+	// InitialBackoff doubles for each attempt until MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Jitter is the fraction of the backoff which is randomized, between 0 and 1.
+	Jitter float64
+	// Retryable reports whether the error is retryable, it is DefaultRetryable if nil.
+	Retryable func(err error) bool
+	// MaxPending is the max count of the messages waiting for retries, the others are dead letters.
+	MaxPending int
+}
+
+// DefaultRetryPolicy retries the transient failures 3 times in about 2 seconds.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 200 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Jitter:         0.2,
+	MaxPending:     10000,
+}
+
+// DefaultRetryable retries the errors except that the client is not connected or the context is done.
+func DefaultRetryable(err error) bool {
+	return !errors.Is(err, core.ErrClientConnectionNotFound) &&
+		!errors.Is(err, context.Canceled) &&
+		!errors.Is(err, context.DeadlineExceeded)
+}
+
+// WithRetryPolicy sets the retry policy of the deliveries, the failed deliveries are not retried by default.
+func WithRetryPolicy(policy RetryPolicy) OptionFunc {
+	return func(r *Raindrop) {
+		if policy.Retryable == nil {
+			policy.Retryable = DefaultRetryable
+		}
+		r.retryPolicy = &policy
+		r.retries = newDelayQueue(policy.MaxPending)
+	}
+}
+
+// Backoff returns the delay before the next attempt.
+func (p *RetryPolicy) Backoff(attempts int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < attempts && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, p.MaxBackoff)
+	if p.Jitter > 0 {
+		d -= time.Duration(float64(d) * p.Jitter * rand.Float64())
+	}
+	return d
+}
+
+func (p *RetryPolicy) retryable(attempts int, err error) bool {
+	return p != nil && attempts < p.MaxAttempts && p.Retryable(err)
+}
+
+// retry is a message waiting to be written to the failed destinations again.
+type retry struct {
+	m            *RawMessage
+	destinations []string
+	attempts     int
+	at           time.Time
+}
+
+type retryHeap []*retry
+
+func (h retryHeap) Len() int           { return len(h) }
+func (h retryHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h retryHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *retryHeap) Push(x any)        { *h = append(*h, x.(*retry)) }
+func (h *retryHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return x
+}
+
+// delayQueue holds the retries until they are due.
+type delayQueue struct {
+	mu    sync.Mutex
+	items retryHeap
+	max   int
+	wake  chan struct{}
+}
+
+func newDelayQueue(max int) *delayQueue {
+	return &delayQueue{max: max, wake: make(chan struct{}, 1)}
+}
+
+func (q *delayQueue) push(r *retry) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.max > 0 && len(q.items) >= q.max {
+		return false
+	}
+	heap.Push(&q.items, r)
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// pop returns the due retry, or the delay until the next one.
+func (q *delayQueue) pop(now time.Time) (*retry, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 {
+		return nil, time.Hour
+	}
+	if d := q.items[0].at.Sub(now); d > 0 {
+		return nil, d
+	}
+	return heap.Pop(&q.items).(*retry), 0
+}
+
+// run calls the function with each due retry until the context is done, and returns the pending ones.
+func (q *delayQueue) run(ctx context.Context, f func(r *retry)) []*retry {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		r, d := q.pop(time.Now())
+		if r != nil {
+			go f(r)
+			continue
+		}
+		timer.Reset(d)
+		select {
+		case <-ctx.Done():
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			pending := q.items
+			q.items = nil
+			return pending
+		case <-q.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+func (r *Raindrop) serveRetries(ctx context.Context) error {
+	pending := r.retries.run(ctx, func(rt *retry) {
+		r.deliver(ctx, rt.m, rt.destinations, rt.attempts+1)
+	})
+	for _, rt := range pending {
+		r.deadLetter(ctx, rt.m, ctx.Err(), rt.destinations, rt.attempts)
+	}
+	return nil
+}
+
+// deliver writes the message to the destinations. The messages of the recipients which are not connected are kept
+// in the offline store, the failed destinations are retried by the retry policy, and the others are dead letters.
+// The message is dropped when it is expired. The destinations are written concurrently by the delivery concurrency.
+// It returns the errors of the destinations which are not retried.
+func (r *Raindrop) deliver(ctx context.Context, m *RawMessage, destinations []string, attempts int) error {
+	if m.Expired(time.Now()) {
+		r.expire(ctx, m, destinations, attempts-1)
+		return nil
+	}
+	ctx = core.WithExpiry(ctx, m.ExpiresAt)
+	errs := make([]error, len(destinations))
+	group := new(errgroup.Group)
+	group.SetLimit(r.concurrency)
+	for i, dst := range destinations {
+		group.Go(func() error {
+			if err := r.server.WriteTo(ctx, dst, m.Data); !r.putOffline(ctx, dst, m, err) {
+				errs[i] = err
+			}
+			return nil
+		})
+	}
+	_ = group.Wait()
+
+	var (
+		retries, failed, expired []string
+		retryErr, failErr        error
+	)
+	for i, dst := range destinations {
+		err := errs[i]
+		switch {
+		case err == nil:
+		case errors.Is(err, core.ErrMessageExpired):
+			expired = append(expired, dst)
+		case r.retryPolicy.retryable(attempts, err):
+			retries = append(retries, dst)
+			retryErr = errors.Join(retryErr, err)
+		default:
+			failed = append(failed, dst)
+			failErr = errors.Join(failErr, err)
+		}
+	}
+	if len(retries) > 0 {
+		rt := &retry{m: m, destinations: retries, attempts: attempts, at: time.Now().Add(r.retryPolicy.Backoff(attempts))}
+		if !r.retries.push(rt) {
+			failed = append(failed, retries...)
+			failErr = errors.Join(failErr, retryErr, ErrRetryQueueFull)
+		}
+	}
+	if len(expired) > 0 {
+		r.expire(ctx, m, expired, attempts)
+	}
+	if len(failed) > 0 {
+		r.deadLetter(ctx, m, failErr, failed, attempts)
+	}
+	return failErr
+}
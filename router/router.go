@@ -0,0 +1,226 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cro4k/raindrop"
+	"github.com/cro4k/raindrop/core"
+	"github.com/cro4k/raindrop/envelope"
+	"github.com/google/uuid"
+)
+
+var ErrRouteNotFound = errors.New("route not found")
+
+type (
+	// HandlerFunc handles an inbound envelope, the returned error is replied to the sender.
+	HandlerFunc func(c *Context) error
+
+	Middleware func(next HandlerFunc) HandlerFunc
+)
+
+// Context is the context of an inbound envelope.
+type Context struct {
+	context.Context
+
+	// ID is the id of the sender.
+	ID       string
+	Envelope *envelope.Envelope
+	Writer   core.Writer
+
+	codecs *raindrop.CodecRegistry
+}
+
+// Bind decodes the payload by the codec in the envelope.HeaderCodec header.
+func (c *Context) Bind(v any) error {
+	return c.codecs.UnmarshalPayload(c.Envelope, v)
+}
+
+// Reply writes an envelope of the type to the sender, its correlation id is the id of the inbound envelope.
+func (c *Context) Reply(typ string, payload []byte) error {
+	return c.write(c.newReply(typ, payload))
+}
+
+// ReplyValue encodes the value by the codec of the inbound envelope, and replies it.
+func (c *Context) ReplyValue(typ string, v any) error {
+	name := c.Envelope.Header(envelope.HeaderCodec)
+	if name == "" {
+		name = raindrop.CodecJSON
+	}
+	codec, err := c.codecs.Get(name)
+	if err != nil {
+		return err
+	}
+	e := c.newReply(typ, nil)
+	if err := raindrop.MarshalPayload(e, codec, v); err != nil {
+		return err
+	}
+	return c.write(e)
+}
+
+func (c *Context) newReply(typ string, payload []byte) *envelope.Envelope {
+	return &envelope.Envelope{
+		Type:          typ,
+		Id:            uuid.NewString(),
+		CorrelationId: c.Envelope.GetId(),
+		Timestamp:     time.Now().UnixMilli(),
+		Payload:       payload,
+	}
+}
+
+func (c *Context) write(e *envelope.Envelope) error {
+	return core.WriteEnvelope(c, c.Writer, c.ID, e)
+}
+
+type route struct {
+	pattern string
+	handler HandlerFunc
+}
+
+// Router dispatches the inbound envelopes to the handlers by their type. A pattern is either a type,
+// or a prefix ending with `*`, e.g. `chat.*`, and `*` matches all the types. The exact type takes precedence
+// over the longest prefix, and the fallback handles the envelopes which match nothing.
+type Router struct {
+	routes      map[string]*route
+	wildcards   []*route
+	fallback    HandlerFunc
+	middlewares []Middleware
+
+	codecs    *raindrop.CodecRegistry
+	errorType string
+}
+
+type Option func(*Router)
+
+// WithCodecs sets the registry of the codecs which decode the payloads, it is raindrop.DefaultCodecs by default.
+func WithCodecs(codecs *raindrop.CodecRegistry) Option {
+	return func(r *Router) {
+		r.codecs = codecs
+	}
+}
+
+// WithErrorType sets the type of the error replies, it is envelope.TypeError by default.
+func WithErrorType(typ string) Option {
+	return func(r *Router) {
+		r.errorType = typ
+	}
+}
+
+func New(options ...Option) *Router {
+	r := &Router{
+		routes:    make(map[string]*route),
+		codecs:    raindrop.DefaultCodecs,
+		errorType: envelope.TypeError,
+	}
+	for _, option := range options {
+		option(r)
+	}
+	return r
+}
+
+// Use adds the middlewares of all the routes, they must be added before the routes.
+func (r *Router) Use(middlewares ...Middleware) {
+	r.middlewares = append(r.middlewares, middlewares...)
+}
+
+// Handle registers the handler of the pattern, the middlewares only apply to this route.
+func (r *Router) Handle(pattern string, h HandlerFunc, middlewares ...Middleware) {
+	rt := &route{pattern: pattern, handler: r.chain(h, middlewares)}
+	prefix, ok := strings.CutSuffix(pattern, "*")
+	if !ok {
+		r.routes[pattern] = rt
+		return
+	}
+	rt.pattern = prefix
+	r.wildcards = append(r.wildcards, rt)
+	sort.SliceStable(r.wildcards, func(i, j int) bool {
+		return len(r.wildcards[i].pattern) > len(r.wildcards[j].pattern)
+	})
+}
+
+// Fallback sets the handler of the envelopes which match no route, they are answered by ErrRouteNotFound by default.
+func (r *Router) Fallback(h HandlerFunc, middlewares ...Middleware) {
+	r.fallback = r.chain(h, middlewares)
+}
+
+func (r *Router) chain(h HandlerFunc, middlewares []Middleware) HandlerFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	for i := len(r.middlewares) - 1; i >= 0; i-- {
+		h = r.middlewares[i](h)
+	}
+	return h
+}
+
+func (r *Router) match(typ string) HandlerFunc {
+	if rt, ok := r.routes[typ]; ok {
+		return rt.handler
+	}
+	for _, rt := range r.wildcards {
+		if strings.HasPrefix(typ, rt.pattern) {
+			return rt.handler
+		}
+	}
+	return r.fallback
+}
+
+// OnClientMessage is the hook of core.WithOnClientMessage.
+func (r *Router) OnClientMessage(ctx context.Context, id string, data []byte, cb core.Writer) {
+	e, _, err := envelope.Decode(data)
+	if err != nil {
+		e = &envelope.Envelope{}
+	}
+	c := &Context{Context: ctx, ID: id, Envelope: e, Writer: cb, codecs: r.codecs}
+	if err != nil {
+		r.replyError(c, err)
+		return
+	}
+	h := r.match(e.GetType())
+	if h == nil {
+		r.replyError(c, fmt.Errorf("%w: %s", ErrRouteNotFound, e.GetType()))
+		return
+	}
+	if err := h(c); err != nil {
+		r.replyError(c, err)
+	}
+}
+
+func (r *Router) replyError(c *Context, err error) {
+	e := c.newReply(r.errorType, nil)
+	e.SetHeader(envelope.HeaderError, err.Error())
+	if err := c.write(e); err != nil {
+		slog.ErrorContext(c, "reply error failed", slog.String("id", c.ID), slog.String("error", err.Error()))
+	}
+}
+
+// Typed adapts a handler of the decoded payload.
+func Typed[T any](h func(c *Context, msg *T) error) HandlerFunc {
+	return func(c *Context) error {
+		msg := new(T)
+		if err := c.Bind(msg); err != nil {
+			return err
+		}
+		return h(c, msg)
+	}
+}
+
+// TypedReply adapts a handler of the decoded payload, whose result is replied in an envelope of the type.
+func TypedReply[T, R any](typ string, h func(c *Context, msg *T) (R, error)) HandlerFunc {
+	return func(c *Context) error {
+		msg := new(T)
+		if err := c.Bind(msg); err != nil {
+			return err
+		}
+		res, err := h(c, msg)
+		if err != nil {
+			return err
+		}
+		return c.ReplyValue(typ, res)
+	}
+}
@@ -0,0 +1,200 @@
+package raindrop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultSchedulePollInterval = time.Second
+
+	scheduleBatchSize = 100
+	// scheduleLeaseTTL is how long a claimed message is leased to the node which publishes it.
+	scheduleLeaseTTL = 30 * time.Second
+)
+
+var ErrScheduledMessageNotFound = errors.New("scheduled message is not found")
+
+// ScheduledMessage is a message which is published when it is due.
+type ScheduledMessage struct {
+	ID      string     `json:"id"`
+	Message RawMessage `json:"message"`
+	DueAt   time.Time  `json:"due_at"`
+}
+
+// DelayStore keeps the scheduled messages until they are due. The nodes sharing a store poll it in turn, only the
+// node which holds the lock publishes the due messages. A due message is leased to the node before it is published,
+// and it is deleted after it is published, so that it is due again if the node fails in between.
+type DelayStore interface {
+	Add(ctx context.Context, m *ScheduledMessage) error
+	// Due returns at most limit messages which are due at now and not leased, in the order of their due time.
+	Due(ctx context.Context, now time.Time, limit int) ([]*ScheduledMessage, error)
+	// Claim leases the message to the owner until the deadline, it reports false if the message is not due or is
+	// leased to another owner. A message whose lease is expired is due again.
+	Claim(ctx context.Context, id, owner string, now, until time.Time) (bool, error)
+	// Ack deletes the message leased to the owner, it returns ErrScheduledMessageNotFound if the message is deleted
+	// or the lease is lost.
+	Ack(ctx context.Context, id, owner string) error
+	// Release makes the message leased to the owner due again, it does nothing if the message is deleted or the
+	// lease is lost.
+	Release(ctx context.Context, id, owner string) error
+	// Delete deletes the message, it returns ErrScheduledMessageNotFound if the message is published or deleted.
+	Delete(ctx context.Context, id string) error
+	// Lock acquires or extends the lock of the owner for the ttl, it reports false if another owner holds it.
+	Lock(ctx context.Context, owner string, ttl time.Duration) (bool, error)
+}
+
+// ScheduleHandle is the handle of a scheduled message.
+type ScheduleHandle struct {
+	ID    string
+	DueAt time.Time
+
+	r *Raindrop
+}
+
+// Cancel cancels the message, it returns ErrScheduledMessageNotFound if the message is published or cancelled. A
+// message which is being published may still be published.
+func (h *ScheduleHandle) Cancel(ctx context.Context) error {
+	return h.r.CancelScheduled(ctx, h.ID)
+}
+
+// WithDelayStore sets the store of the messages sent by SendAt and SendAfter, which is polled every interval,
+// the interval is DefaultSchedulePollInterval if it is not positive.
+func WithDelayStore(store DelayStore, interval time.Duration) OptionFunc {
+	return func(r *Raindrop) {
+		if interval <= 0 {
+			interval = DefaultSchedulePollInterval
+		}
+		r.delays = store
+		r.pollInterval = interval
+	}
+}
+
+// SendAt publishes the message at the time, the message is kept by the delay store until then. The messages
+// are published in the poll interval after they are due.
+func (r *Raindrop) SendAt(ctx context.Context, id string, data []byte, at time.Time) (*ScheduleHandle, error) {
+	return r.SendMessageAt(ctx, &RawMessage{ID: id, Data: data}, at)
+}
+
+// SendAfter publishes the message after the delay.
+func (r *Raindrop) SendAfter(ctx context.Context, id string, data []byte, delay time.Duration) (*ScheduleHandle, error) {
+	return r.SendAt(ctx, id, data, time.Now().Add(delay))
+}
+
+// SendMessageAt publishes the message at the time, e.g. with its recipients and headers. The timestamp and the
+// expiry are set if they are zero.
+func (r *Raindrop) SendMessageAt(ctx context.Context, msg *RawMessage, at time.Time) (*ScheduleHandle, error) {
+	if r.delays == nil {
+		return nil, fmt.Errorf("delay store is not set")
+	}
+	m := &ScheduledMessage{ID: uuid.NewString(), Message: *msg, DueAt: at}
+	if m.Message.Timestamp.IsZero() {
+		m.Message.Timestamp = time.Now()
+	}
+	if m.Message.ExpiresAt.IsZero() {
+		m.Message.ExpiresAt = r.expiry(ctx, at)
+	}
+	if err := r.delays.Add(ctx, m); err != nil {
+		return nil, err
+	}
+	return &ScheduleHandle{ID: m.ID, DueAt: m.DueAt, r: r}, nil
+}
+
+// CancelScheduled cancels the scheduled message of the id of its handle, e.g. on another node or after a restart.
+func (r *Raindrop) CancelScheduled(ctx context.Context, id string) error {
+	if r.delays == nil {
+		return fmt.Errorf("delay store is not set")
+	}
+	return r.delays.Delete(ctx, id)
+}
+
+// serveSchedules polls the delay store, and publishes the due messages while the node holds the lock, which is
+// acquired again for each batch. A message is leased before it is published, so that a message which is cancelled,
+// or claimed by another node after the lock is lost, is not published. A message is deleted after it is published,
+// and a message which fails to be published is released to be published by the next poll.
+func (r *Raindrop) serveSchedules(ctx context.Context) error {
+	owner := uuid.NewString()
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		r.publishDue(ctx, owner)
+	}
+}
+
+func (r *Raindrop) publishDue(ctx context.Context, owner string) {
+	for {
+		locked, err := r.delays.Lock(ctx, owner, 3*r.pollInterval)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "lock delay store failed", slog.String("error", err.Error()))
+			return
+		}
+		if !locked {
+			return
+		}
+		list, err := r.delays.Due(ctx, time.Now(), scheduleBatchSize)
+		if err != nil {
+			slog.ErrorContext(ctx, "list due messages failed", slog.String("error", err.Error()))
+			return
+		}
+		for _, m := range list {
+			if !r.publishScheduled(ctx, owner, m) {
+				return
+			}
+		}
+		if len(list) < scheduleBatchSize {
+			return
+		}
+	}
+}
+
+// publishScheduled claims, publishes and acknowledges the message, it reports false if the store or the publisher
+// fails.
+func (r *Raindrop) publishScheduled(ctx context.Context, owner string, m *ScheduledMessage) bool {
+	now := time.Now()
+	claimed, err := r.delays.Claim(ctx, m.ID, owner, now, now.Add(scheduleLeaseTTL))
+	if err != nil {
+		slog.ErrorContext(ctx, "claim scheduled message failed", slog.String("id", m.ID),
+			slog.String("error", err.Error()))
+		return false
+	}
+	if !claimed {
+		return true
+	}
+	if m.Message.Expired(now) {
+		r.expire(ctx, &m.Message, nil, 0)
+	} else if err := r.pub.Publish(ctx, &m.Message); err != nil {
+		slog.ErrorContext(ctx, "publish scheduled message failed", slog.String("id", m.ID),
+			slog.String("message", m.Message.ID), slog.String("error", err.Error()))
+		if err := r.delays.Release(context.WithoutCancel(ctx), m.ID, owner); err != nil {
+			slog.ErrorContext(ctx, "release scheduled message failed", slog.String("id", m.ID),
+				slog.String("message", m.Message.ID), slog.String("error", err.Error()))
+		}
+		return false
+	}
+	err = r.delays.Ack(context.WithoutCancel(ctx), m.ID, owner)
+	if errors.Is(err, ErrScheduledMessageNotFound) {
+		// the message is cancelled meanwhile, or its lease is expired and it may be published again
+		slog.WarnContext(ctx, "scheduled message is not acknowledged", slog.String("id", m.ID),
+			slog.String("message", m.Message.ID))
+		return true
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "acknowledge scheduled message failed", slog.String("id", m.ID),
+			slog.String("message", m.Message.ID), slog.String("error", err.Error()))
+		return false
+	}
+	return true
+}
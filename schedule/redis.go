@@ -0,0 +1,199 @@
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/cro4k/raindrop"
+	"github.com/redis/go-redis/v9"
+)
+
+type options struct {
+	prefix string
+	table  string
+}
+
+type Option func(*options)
+
+// WithPrefix sets the prefix of the keys of the RedisStore.
+func WithPrefix(prefix string) Option {
+	return func(o *options) {
+		o.prefix = prefix
+	}
+}
+
+// WithTable sets the table of the SQLiteStore, the lock is kept in the table of the "_lock" suffix.
+func WithTable(table string) Option {
+	return func(o *options) {
+		o.table = table
+	}
+}
+
+func applyOptions(opts ...Option) *options {
+	o := &options{
+		prefix: "{RAINDROP_SCHEDULE}:",
+		table:  "raindrop_scheduled_messages",
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+var (
+	deleteScript = redis.NewScript(`
+redis.call('HDEL', KEYS[2], ARGV[1])
+redis.call('HDEL', KEYS[3], ARGV[1])
+return redis.call('ZREM', KEYS[1], ARGV[1])`)
+
+	// claimScript moves the score of a due message to the deadline of its lease.
+	claimScript = redis.NewScript(`
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not score or tonumber(score) > tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[3], ARGV[1])
+redis.call('HSET', KEYS[3], ARGV[1], ARGV[4])
+return 1`)
+
+	ackScript = redis.NewScript(`
+if redis.call('HGET', KEYS[3], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+redis.call('HDEL', KEYS[2], ARGV[1])
+redis.call('HDEL', KEYS[3], ARGV[1])
+return redis.call('ZREM', KEYS[1], ARGV[1])`)
+
+	releaseScript = redis.NewScript(`
+if redis.call('HGET', KEYS[3], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+redis.call('HDEL', KEYS[3], ARGV[1])
+return redis.call('ZADD', KEYS[1], 'XX', ARGV[3], ARGV[1])`)
+
+	lockScript = redis.NewScript(`
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return 1
+end
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return 1
+end
+return 0`)
+)
+
+// RedisStore keeps the ids of the scheduled messages in a redis sorted set by their due time, and the messages in
+// a redis hash. A leased message is scored by the deadline of its lease, and its owner is kept in another hash. The
+// keys share a hash tag, so that the prefix should have one in a redis cluster.
+type RedisStore struct {
+	client redis.UniversalClient
+	*options
+}
+
+func NewRedisStore(client redis.UniversalClient, opts ...Option) *RedisStore {
+	return &RedisStore{client: client, options: applyOptions(opts...)}
+}
+
+func (s *RedisStore) Add(ctx context.Context, m *raindrop.ScheduledMessage) error {
+	val, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, s.messagesKey(), m.ID, val)
+		pipe.ZAdd(ctx, s.queueKey(), redis.Z{Score: float64(m.DueAt.UnixMilli()), Member: m.ID})
+		return nil
+	})
+	return err
+}
+
+func (s *RedisStore) Due(ctx context.Context, now time.Time, limit int) ([]*raindrop.ScheduledMessage, error) {
+	ids, err := s.client.ZRangeArgs(ctx, redis.ZRangeArgs{
+		Key:     s.queueKey(),
+		Start:   "-inf",
+		Stop:    strconv.FormatInt(now.UnixMilli(), 10),
+		ByScore: true,
+		Count:   int64(limit),
+	}).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	values, err := s.client.HMGet(ctx, s.messagesKey(), ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*raindrop.ScheduledMessage, 0, len(values))
+	for i, v := range values {
+		val, ok := v.(string)
+		if !ok {
+			// the message is deleted after its id is read.
+			continue
+		}
+		m := new(raindrop.ScheduledMessage)
+		if err := json.Unmarshal([]byte(val), m); err != nil {
+			return nil, err
+		}
+		m.ID = ids[i]
+		list = append(list, m)
+	}
+	return list, nil
+}
+
+func (s *RedisStore) Claim(ctx context.Context, id, owner string, now, until time.Time) (bool, error) {
+	n, err := claimScript.Run(ctx, s.client, s.keys(), id, now.UnixMilli(), until.UnixMilli(), owner).Int()
+	return n == 1, err
+}
+
+func (s *RedisStore) Ack(ctx context.Context, id, owner string) error {
+	n, err := ackScript.Run(ctx, s.client, s.keys(), id, owner).Int()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return raindrop.ErrScheduledMessageNotFound
+	}
+	return nil
+}
+
+func (s *RedisStore) Release(ctx context.Context, id, owner string) error {
+	return releaseScript.Run(ctx, s.client, s.keys(), id, owner, time.Now().UnixMilli()).Err()
+}
+
+func (s *RedisStore) Delete(ctx context.Context, id string) error {
+	n, err := deleteScript.Run(ctx, s.client, s.keys(), id).Int()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return raindrop.ErrScheduledMessageNotFound
+	}
+	return nil
+}
+
+func (s *RedisStore) Lock(ctx context.Context, owner string, ttl time.Duration) (bool, error) {
+	n, err := lockScript.Run(ctx, s.client, []string{s.lockKey()}, owner, ttl.Milliseconds()).Int()
+	return n == 1, err
+}
+
+// keys returns the keys of the scripts.
+func (s *RedisStore) keys() []string {
+	return []string{s.queueKey(), s.messagesKey(), s.leasesKey()}
+}
+
+func (s *RedisStore) queueKey() string {
+	return s.prefix + "QUEUE"
+}
+
+func (s *RedisStore) messagesKey() string {
+	return s.prefix + "MESSAGES"
+}
+
+func (s *RedisStore) leasesKey() string {
+	return s.prefix + "LEASES"
+}
+
+func (s *RedisStore) lockKey() string {
+	return s.prefix + "LOCK"
+}
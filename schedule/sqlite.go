@@ -0,0 +1,146 @@
+package schedule
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/cro4k/raindrop"
+	"github.com/cro4k/raindrop/internal/sqlutil"
+)
+
+// SQLiteStore keeps the scheduled messages in a sqlite table, e.g. for a single node. The database is opened by
+// the application with the driver of its choice, e.g. github.com/mattn/go-sqlite3 or modernc.org/sqlite.
+type SQLiteStore struct {
+	db *sql.DB
+	*options
+}
+
+// NewSQLiteStore creates the store, and the tables if they do not exist.
+func NewSQLiteStore(ctx context.Context, db *sql.DB, opts ...Option) (*SQLiteStore, error) {
+	s := &SQLiteStore{db: db, options: applyOptions(opts...)}
+	for _, query := range []string{
+		`CREATE TABLE IF NOT EXISTS %[1]s (
+	id TEXT PRIMARY KEY,
+	message_id TEXT NOT NULL,
+	data BLOB,
+	recipients TEXT NOT NULL,
+	headers TEXT NOT NULL,
+	timestamp INTEGER NOT NULL,
+	expires_at INTEGER NOT NULL,
+	due_at INTEGER NOT NULL,
+	lease_owner TEXT NOT NULL DEFAULT '',
+	leased_until INTEGER NOT NULL DEFAULT 0
+)`,
+		`CREATE INDEX IF NOT EXISTS %[1]s_due_at ON %[1]s (due_at)`,
+		`CREATE TABLE IF NOT EXISTS %[1]s_lock (
+	name TEXT PRIMARY KEY,
+	owner TEXT NOT NULL,
+	expires_at INTEGER NOT NULL
+)`,
+	} {
+		if _, err := db.ExecContext(ctx, fmt.Sprintf(query, s.table)); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *SQLiteStore) Add(ctx context.Context, m *raindrop.ScheduledMessage) error {
+	recipients, headers, err := sqlutil.MarshalAttributes(&m.Message)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s
+		(id, message_id, data, recipients, headers, timestamp, expires_at, due_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.table), m.ID, m.Message.ID, m.Message.Data, recipients, headers, m.Message.Timestamp.UnixNano(),
+		sqlutil.UnixNano(m.Message.ExpiresAt), m.DueAt.UnixMilli())
+	return err
+}
+
+func (s *SQLiteStore) Due(ctx context.Context, now time.Time, limit int) ([]*raindrop.ScheduledMessage, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(
+		`SELECT id, message_id, data, recipients, headers, timestamp, expires_at, due_at FROM %s WHERE due_at <= ? AND leased_until <= ? ORDER BY due_at LIMIT ?`,
+		s.table), now.UnixMilli(), now.UnixMilli(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []*raindrop.ScheduledMessage
+	for rows.Next() {
+		var (
+			recipients, headers         []byte
+			timestamp, expiresAt, dueAt int64
+			m                           = new(raindrop.ScheduledMessage)
+		)
+		err := rows.Scan(&m.ID, &m.Message.ID, &m.Message.Data, &recipients, &headers, &timestamp, &expiresAt, &dueAt)
+		if err != nil {
+			return nil, err
+		}
+		if err := sqlutil.UnmarshalAttributes(&m.Message, recipients, headers); err != nil {
+			return nil, err
+		}
+		m.Message.Timestamp = time.Unix(0, timestamp)
+		m.Message.ExpiresAt = sqlutil.FromUnixNano(expiresAt)
+		m.DueAt = time.UnixMilli(dueAt)
+		list = append(list, m)
+	}
+	return list, rows.Err()
+}
+
+func (s *SQLiteStore) Claim(ctx context.Context, id, owner string, now, until time.Time) (bool, error) {
+	res, err := s.db.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET lease_owner = ?, leased_until = ? WHERE id = ? AND due_at <= ? AND leased_until <= ?`, s.table),
+		owner, until.UnixMilli(), id, now.UnixMilli(), now.UnixMilli())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (s *SQLiteStore) Ack(ctx context.Context, id, owner string) error {
+	res, err := s.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE id = ? AND lease_owner = ?`, s.table),
+		id, owner)
+	return s.affected(res, err)
+}
+
+func (s *SQLiteStore) Release(ctx context.Context, id, owner string) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET lease_owner = '', leased_until = 0 WHERE id = ? AND lease_owner = ?`, s.table), id, owner)
+	return err
+}
+
+func (s *SQLiteStore) Delete(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE id = ?`, s.table), id)
+	return s.affected(res, err)
+}
+
+// affected returns ErrScheduledMessageNotFound if no row is affected.
+func (s *SQLiteStore) affected(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return raindrop.ErrScheduledMessageNotFound
+	}
+	return nil
+}
+
+// Lock keeps the lock in a row, so that the processes sharing the database file poll it in turn.
+func (s *SQLiteStore) Lock(ctx context.Context, owner string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	res, err := s.db.ExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %[1]s_lock (name, owner, expires_at) VALUES ('poller', ?, ?)
+		ON CONFLICT (name) DO UPDATE SET owner = excluded.owner, expires_at = excluded.expires_at
+		WHERE %[1]s_lock.owner = excluded.owner OR %[1]s_lock.expires_at < ?`, s.table),
+		owner, now.Add(ttl).UnixMilli(), now.UnixMilli())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
@@ -0,0 +1,52 @@
+package raindrop
+
+import (
+	"context"
+	"errors"
+
+	"github.com/cro4k/raindrop/core"
+	"github.com/google/uuid"
+)
+
+// HeaderTopic is the header of the messages published to a topic.
+const HeaderTopic = "topic"
+
+// TopicPublisher writes the messages to the subscribers of the topics, e.g. topic.Broker.
+type TopicPublisher interface {
+	Publish(ctx context.Context, topic string, data []byte) error
+}
+
+type runner interface {
+	Run(ctx context.Context) error
+}
+
+// WithTopicPublisher sets the publisher of the messages sent by Publish. If it is a runner, e.g. topic.Broker, it is
+// run by Start.
+func WithTopicPublisher(p TopicPublisher) OptionFunc {
+	return func(r *Raindrop) {
+		r.topics = p
+	}
+}
+
+// Publish publishes the message to the subscribers of the topic. The message is published by the message
+// publisher, and the node which receives it writes it once to each node which has subscribers of the topic.
+func (r *Raindrop) Publish(ctx context.Context, topic string, data []byte) error {
+	m := &RawMessage{ID: uuid.NewString(), Data: data}
+	m.SetHeader(HeaderTopic, topic)
+	return r.SendMessage(ctx, m)
+}
+
+// publishTopic writes the message to the subscribers of its topic, the failures are dead letters. It reports
+// whether the message is published.
+func (r *Raindrop) publishTopic(ctx context.Context, m *RawMessage, topic string) bool {
+	err := r.topics.Publish(core.WithExpiry(ctx, m.ExpiresAt), topic, m.Data)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, core.ErrMessageExpired):
+		r.expire(ctx, m, nil, 1)
+	default:
+		r.deadLetter(ctx, m, err, nil, 1)
+	}
+	return false
+}
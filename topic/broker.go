@@ -0,0 +1,294 @@
+package topic
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/cro4k/raindrop/core"
+	"github.com/cro4k/raindrop/envelope"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	DefaultTrackerTTL  = 30 * time.Second
+	DefaultConcurrency = 64
+)
+
+// Nodes discovers the writers of the nodes by their identities, e.g. registry.NodeDialer, the writers should
+// implement core.TopicWriter.
+type Nodes interface {
+	DiscoverNode(ctx context.Context, node string) (core.Writer, error)
+}
+
+// Broker is a core.Interceptor which subscribes the clients of a node to the topics by the envelopes of
+// envelope.TypeSubscribe and envelope.TypeUnsubscribe, or by Subscribe and Unsubscribe. The subscriptions of a
+// client are dropped when its session is closed.
+//
+// In a cluster, the patterns of each node are tracked by the Tracker, and a message is published once to each node
+// which has subscribers of its topic, which writes it to its subscribers. The broker should be set as the topic
+// writer of the registry.GRPCRegistryServer of the node, and it should be run to refresh the patterns of the node,
+// which is done by Raindrop.Start.
+type Broker struct {
+	tracker     Tracker
+	node        string
+	nodes       Nodes
+	ttl         time.Duration
+	concurrency int
+	authorize   func(ctx context.Context, s *core.Session, pattern string) error
+
+	index *index
+
+	mu       sync.RWMutex
+	sessions map[string]*core.Session
+}
+
+type Option func(*Broker)
+
+// WithCluster sets the tracker of the patterns, the identity of the node (e.g. the host of its connector), and the
+// discovery of the other nodes. Without it, the messages are only published to the clients of the node.
+func WithCluster(tracker Tracker, node string, nodes Nodes) Option {
+	return func(b *Broker) {
+		b.tracker = tracker
+		b.node = node
+		b.nodes = nodes
+	}
+}
+
+// WithTrackerTTL sets how long the patterns of the node are tracked without being refreshed.
+func WithTrackerTTL(ttl time.Duration) Option {
+	return func(b *Broker) {
+		b.ttl = ttl
+	}
+}
+
+// WithConcurrency sets how many subscribers of the node are written at the same time.
+func WithConcurrency(concurrency int) Option {
+	return func(b *Broker) {
+		b.concurrency = concurrency
+	}
+}
+
+// WithSubscribeAuthorizer sets the authorizer of the subscriptions of the clients, a subscription is denied by its
+// error, e.g. a pattern of the presence topics of other users. The subscriptions of the server by Subscribe are not
+// authorized, and all the subscriptions are allowed without it.
+func WithSubscribeAuthorizer(authorize func(ctx context.Context, s *core.Session, pattern string) error) Option {
+	return func(b *Broker) {
+		b.authorize = authorize
+	}
+}
+
+func NewBroker(options ...Option) *Broker {
+	b := &Broker{
+		ttl:         DefaultTrackerTTL,
+		concurrency: DefaultConcurrency,
+		index:       newIndex(),
+		sessions:    make(map[string]*core.Session),
+	}
+	for _, option := range options {
+		option(b)
+	}
+	return b
+}
+
+// Subscribe subscribes the client of the node to the topics matching the pattern.
+func (b *Broker) Subscribe(ctx context.Context, id, pattern string) error {
+	if err := ValidatePattern(pattern); err != nil {
+		return err
+	}
+	if _, ok := b.session(id); !ok {
+		return core.ErrClientConnectionNotFound
+	}
+	if !b.index.add(id, pattern) || b.tracker == nil {
+		return nil
+	}
+	if err := b.tracker.Add(ctx, b.node, b.ttl, pattern); err != nil {
+		b.index.remove(id, pattern)
+		return err
+	}
+	return nil
+}
+
+// Unsubscribe unsubscribes the client of the node from the pattern.
+func (b *Broker) Unsubscribe(ctx context.Context, id, pattern string) error {
+	if !b.index.remove(id, pattern) || b.tracker == nil {
+		return nil
+	}
+	return b.tracker.Remove(ctx, b.node, pattern)
+}
+
+// Publish writes the data to the subscribers of the topic of all the nodes, the topic is set in the envelope if
+// the data is an envelope.
+func (b *Broker) Publish(ctx context.Context, topic string, data []byte) error {
+	if err := ValidateTopic(topic); err != nil {
+		return err
+	}
+	if e, format, err := envelope.Decode(data); err == nil && e.Header(envelope.HeaderTopic) != topic {
+		e.SetHeader(envelope.HeaderTopic, topic)
+		if data, err = envelope.Encode(e, format); err != nil {
+			return err
+		}
+	}
+	if b.tracker == nil {
+		return b.WriteToTopic(ctx, topic, data)
+	}
+	nodes, err := b.tracker.Nodes(ctx, topic)
+	if err != nil {
+		return err
+	}
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs error
+	)
+	for _, node := range nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := b.publishTo(ctx, node, topic, data); err != nil {
+				mu.Lock()
+				errs = errors.Join(errs, err)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+func (b *Broker) publishTo(ctx context.Context, node, topic string, data []byte) error {
+	if node == b.node {
+		return b.WriteToTopic(ctx, topic, data)
+	}
+	w, err := b.nodes.DiscoverNode(ctx, node)
+	if err != nil {
+		return err
+	}
+	tw, ok := w.(core.TopicWriter)
+	if !ok {
+		return core.ErrTopicsNotSupported
+	}
+	return tw.WriteToTopic(ctx, topic, data)
+}
+
+// WriteToTopic writes the data to the subscribers of the topic of the node. The failed writes are logged, so that
+// a slow or gone subscriber does not fail the others.
+func (b *Broker) WriteToTopic(ctx context.Context, topic string, data []byte) error {
+	if expiry := core.ExpiryFromContext(ctx); !expiry.IsZero() && !time.Now().Before(expiry) {
+		return core.ErrMessageExpired
+	}
+	group := new(errgroup.Group)
+	group.SetLimit(b.concurrency)
+	for _, id := range b.index.match(topic) {
+		s, ok := b.session(id)
+		if !ok {
+			continue
+		}
+		group.Go(func() error {
+			if err := s.Write(ctx, data); err != nil && !errors.Is(err, core.ErrClientDisconnected) {
+				slog.ErrorContext(ctx, "write topic message failed", slog.String("id", id),
+					slog.String("topic", topic), slog.String("error", err.Error()))
+			}
+			return nil
+		})
+	}
+	return group.Wait()
+}
+
+// Run refreshes the patterns of the node in the tracker until the context is done.
+func (b *Broker) Run(ctx context.Context) error {
+	if b.tracker == nil {
+		return nil
+	}
+	ticker := time.NewTicker(b.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		if err := b.tracker.Add(ctx, b.node, b.ttl, b.index.all()...); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "refresh topic patterns failed", slog.String("node", b.node),
+				slog.String("error", err.Error()))
+		}
+	}
+}
+
+func (b *Broker) session(id string) (*core.Session, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	s, ok := b.sessions[id]
+	return s, ok
+}
+
+func (b *Broker) Outbound(ctx context.Context, s *core.Session, data []byte) ([]byte, error) {
+	return data, nil
+}
+
+func (b *Broker) Inbound(ctx context.Context, s *core.Session, data []byte) ([]byte, error) {
+	e, format, err := envelope.Decode(data)
+	if err != nil {
+		return data, nil
+	}
+	switch e.GetType() {
+	case envelope.TypeSubscribe:
+		pattern := e.Header(envelope.HeaderTopic)
+		if b.authorize != nil {
+			err = b.authorize(ctx, s, pattern)
+		}
+		if err == nil {
+			err = b.Subscribe(ctx, s.ID, pattern)
+		}
+	case envelope.TypeUnsubscribe:
+		err = b.Unsubscribe(ctx, s.ID, e.Header(envelope.HeaderTopic))
+	default:
+		return data, nil
+	}
+	b.answer(ctx, s, e, format, err)
+	return nil, nil
+}
+
+// answer acks the subscribe or the unsubscribe, or reports its error.
+func (b *Broker) answer(ctx context.Context, s *core.Session, req *envelope.Envelope, format envelope.Format, err error) {
+	res := &envelope.Envelope{Type: envelope.TypeAck, CorrelationId: req.GetId(), Timestamp: time.Now().UnixMilli()}
+	if err != nil {
+		res.Type = envelope.TypeError
+		res.SetHeader(envelope.HeaderError, err.Error())
+	}
+	res.SetHeader(envelope.HeaderTopic, req.Header(envelope.HeaderTopic))
+	data, err := envelope.Encode(res, format)
+	if err == nil {
+		err = s.Write(ctx, data)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "answer subscription failed", slog.String("id", s.ID), slog.String("error", err.Error()))
+	}
+}
+
+func (b *Broker) SessionOpened(ctx context.Context, s *core.Session) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sessions[s.ID] = s
+}
+
+// SessionClosed drops the subscriptions of the client.
+func (b *Broker) SessionClosed(ctx context.Context, s *core.Session) {
+	b.mu.Lock()
+	if b.sessions[s.ID] != s {
+		b.mu.Unlock()
+		return
+	}
+	delete(b.sessions, s.ID)
+	b.mu.Unlock()
+	gone := b.index.removeClient(s.ID)
+	if b.tracker == nil || len(gone) == 0 {
+		return
+	}
+	if err := b.tracker.Remove(context.WithoutCancel(ctx), b.node, gone...); err != nil {
+		slog.ErrorContext(ctx, "remove topic patterns failed", slog.String("node", b.node),
+			slog.String("error", err.Error()))
+	}
+}
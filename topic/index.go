@@ -0,0 +1,115 @@
+package topic
+
+import "sync"
+
+// index is the subscriptions of the local clients. The exact patterns are looked up, and the wildcard ones are
+// matched one by one, since there are usually a few of them.
+type index struct {
+	mu        sync.RWMutex
+	patterns  map[string]map[string]struct{}
+	wildcards map[string]struct{}
+	clients   map[string]map[string]struct{}
+}
+
+func newIndex() *index {
+	return &index{
+		patterns:  make(map[string]map[string]struct{}),
+		wildcards: make(map[string]struct{}),
+		clients:   make(map[string]map[string]struct{}),
+	}
+}
+
+// add subscribes the client to the pattern, it reports whether the pattern is new on the node.
+func (x *index) add(id, pattern string) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	ids, ok := x.patterns[pattern]
+	if !ok {
+		ids = make(map[string]struct{})
+		x.patterns[pattern] = ids
+		if IsWildcard(pattern) {
+			x.wildcards[pattern] = struct{}{}
+		}
+	}
+	ids[id] = struct{}{}
+	if x.clients[id] == nil {
+		x.clients[id] = make(map[string]struct{})
+	}
+	x.clients[id][pattern] = struct{}{}
+	return !ok
+}
+
+// remove unsubscribes the client from the pattern, it reports whether the pattern is gone from the node.
+func (x *index) remove(id, pattern string) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.removeLocked(id, pattern)
+}
+
+func (x *index) removeLocked(id, pattern string) bool {
+	ids, ok := x.patterns[pattern]
+	if !ok {
+		return false
+	}
+	if _, ok := ids[id]; !ok {
+		return false
+	}
+	delete(ids, id)
+	delete(x.clients[id], pattern)
+	if len(x.clients[id]) == 0 {
+		delete(x.clients, id)
+	}
+	if len(ids) > 0 {
+		return false
+	}
+	delete(x.patterns, pattern)
+	delete(x.wildcards, pattern)
+	return true
+}
+
+// removeClient unsubscribes the client from all its patterns, it returns the patterns which are gone from the node.
+func (x *index) removeClient(id string) []string {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	var gone []string
+	for pattern := range x.clients[id] {
+		if x.removeLocked(id, pattern) {
+			gone = append(gone, pattern)
+		}
+	}
+	return gone
+}
+
+// match returns the clients subscribing to the topic, each client is returned once.
+func (x *index) match(topic string) []string {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	seen := make(map[string]struct{}, len(x.patterns[topic]))
+	var ids []string
+	add := func(set map[string]struct{}) {
+		for id := range set {
+			if _, ok := seen[id]; !ok {
+				seen[id] = struct{}{}
+				ids = append(ids, id)
+			}
+		}
+	}
+	add(x.patterns[topic])
+	for pattern := range x.wildcards {
+		if Match(pattern, topic) {
+			add(x.patterns[pattern])
+		}
+	}
+	return ids
+}
+
+// all returns the patterns subscribed on the node.
+func (x *index) all() []string {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	patterns := make([]string, 0, len(x.patterns))
+	for pattern := range x.patterns {
+		patterns = append(patterns, pattern)
+	}
+	return patterns
+}
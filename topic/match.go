@@ -0,0 +1,68 @@
+package topic
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	// Any matches one segment of a topic, e.g. "stock.*" matches "stock.aapl" but not "stock.aapl.price".
+	Any = "*"
+	// Rest matches the rest segments of a topic, it is the last segment of a pattern, e.g. "stock.#" matches
+	// "stock", "stock.aapl" and "stock.aapl.price".
+	Rest = "#"
+)
+
+var (
+	ErrInvalidTopic   = errors.New("invalid topic")
+	ErrInvalidPattern = errors.New("invalid pattern")
+)
+
+// ValidateTopic checks the topic, its segments are separated by dots, and none of them is empty or a wildcard.
+func ValidateTopic(topic string) error {
+	for _, s := range strings.Split(topic, ".") {
+		if s == "" || s == Any || s == Rest {
+			return ErrInvalidTopic
+		}
+	}
+	return nil
+}
+
+// ValidatePattern checks the pattern, it is a topic whose segments may be Any, and whose last segment may be Rest.
+func ValidatePattern(pattern string) error {
+	segments := strings.Split(pattern, ".")
+	for i, s := range segments {
+		if s == "" || (s == Rest && i < len(segments)-1) {
+			return ErrInvalidPattern
+		}
+	}
+	return nil
+}
+
+// IsWildcard reports whether the pattern matches more than one topic.
+func IsWildcard(pattern string) bool {
+	for _, s := range strings.Split(pattern, ".") {
+		if s == Any || s == Rest {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether the topic matches the pattern.
+func Match(pattern, topic string) bool {
+	for {
+		p, pRest, pMore := strings.Cut(pattern, ".")
+		if p == Rest {
+			return true
+		}
+		t, tRest, tMore := strings.Cut(topic, ".")
+		if p != Any && p != t {
+			return false
+		}
+		if !pMore || !tMore {
+			return pMore == tMore || pRest == Rest
+		}
+		pattern, topic = pRest, tRest
+	}
+}
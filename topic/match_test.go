@@ -0,0 +1,47 @@
+package topic
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		topic   string
+		want    bool
+	}{
+		{"a.b", "a.b", true},
+		{"a.b", "a.c", false},
+		{"a.b", "a", false},
+		{"a", "a.b", false},
+		{"a.b.c", "a.b", false},
+		{"a.b", "a.b.c", false},
+
+		{"*", "a", true},
+		{"*", "a.b", false},
+		{"a.*", "a.b", true},
+		{"a.*", "a", false},
+		{"a.*", "a.b.c", false},
+		{"*.b", "a.b", true},
+		{"*.b", "a.c", false},
+		{"a.*.c", "a.b.c", true},
+		{"a.*.c", "a.b.d", false},
+		{"*.*", "a.b", true},
+
+		{"#", "a", true},
+		{"#", "a.b.c", true},
+		{"a.#", "a", true},
+		{"a.#", "a.b", true},
+		{"a.#", "a.b.c", true},
+		{"a.#", "b", false},
+		{"a.#", "b.a", false},
+		{"a.b.#", "a", false},
+		{"a.*.#", "a.b", true},
+		{"a.*.#", "a.b.c.d", true},
+		{"a.*.#", "a", false},
+		{"*.#", "a", true},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.topic); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.topic, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package topic
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisTracker keeps the nodes of each pattern in a redis sorted set by their expiries, and the wildcard patterns
+// in a redis sorted set by their expiries. The wildcard patterns are matched by the nodes which publish, so that
+// the count of the distinct wildcard patterns should be moderate, while the exact patterns are read by the topics.
+type RedisTracker struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+type RedisTrackerOption func(*RedisTracker)
+
+func WithPrefix(prefix string) RedisTrackerOption {
+	return func(t *RedisTracker) {
+		t.prefix = prefix
+	}
+}
+
+func NewRedisTracker(client redis.UniversalClient, options ...RedisTrackerOption) *RedisTracker {
+	t := &RedisTracker{
+		client: client,
+		prefix: "RAINDROP_TOPICS:",
+	}
+	for _, option := range options {
+		option(t)
+	}
+	return t
+}
+
+func (t *RedisTracker) Add(ctx context.Context, node string, ttl time.Duration, patterns ...string) error {
+	if len(patterns) == 0 {
+		return nil
+	}
+	expiry := float64(time.Now().Add(ttl).UnixMilli())
+	_, err := t.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, pattern := range patterns {
+			pipe.ZAdd(ctx, t.nodesKey(pattern), redis.Z{Score: expiry, Member: node})
+			pipe.PExpire(ctx, t.nodesKey(pattern), ttl)
+			if IsWildcard(pattern) {
+				pipe.ZAddGT(ctx, t.wildcardsKey(), redis.Z{Score: expiry, Member: pattern})
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+func (t *RedisTracker) Remove(ctx context.Context, node string, patterns ...string) error {
+	if len(patterns) == 0 {
+		return nil
+	}
+	_, err := t.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, pattern := range patterns {
+			pipe.ZRem(ctx, t.nodesKey(pattern), node)
+		}
+		return nil
+	})
+	return err
+}
+
+// Nodes reads the nodes of the topic as an exact pattern, and matches the wildcard patterns, so that a publish
+// does not read the exact patterns of the other topics.
+func (t *RedisTracker) Nodes(ctx context.Context, topic string) ([]string, error) {
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	live := func(key string) redis.ZRangeArgs {
+		return redis.ZRangeArgs{Key: key, Start: "(" + now, Stop: "+inf", ByScore: true}
+	}
+	var wildcards *redis.StringSliceCmd
+	cmds := make([]*redis.StringSliceCmd, 1)
+	_, err := t.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRemRangeByScore(ctx, t.wildcardsKey(), "-inf", now)
+		wildcards = pipe.ZRangeArgs(ctx, live(t.wildcardsKey()))
+		cmds[0] = pipe.ZRangeArgs(ctx, live(t.nodesKey(topic)))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var matched []string
+	for _, pattern := range wildcards.Val() {
+		if Match(pattern, topic) {
+			matched = append(matched, pattern)
+		}
+	}
+	if len(matched) > 0 {
+		_, err = t.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, pattern := range matched {
+				cmds = append(cmds, pipe.ZRangeArgs(ctx, live(t.nodesKey(pattern))))
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	seen := make(map[string]struct{})
+	var nodes []string
+	for _, cmd := range cmds {
+		for _, node := range cmd.Val() {
+			if _, ok := seen[node]; !ok {
+				seen[node] = struct{}{}
+				nodes = append(nodes, node)
+			}
+		}
+	}
+	return nodes, nil
+}
+
+func (t *RedisTracker) wildcardsKey() string {
+	return t.prefix + "WILDCARDS"
+}
+
+func (t *RedisTracker) nodesKey(pattern string) string {
+	return t.prefix + "NODES:" + pattern
+}
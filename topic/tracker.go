@@ -0,0 +1,83 @@
+package topic
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Tracker tracks the patterns subscribed on each node of a cluster, so that a message is published once to each
+// node which has subscribers of its topic. The patterns of a node expire after the ttl unless they are added
+// again, so that the patterns of a failed node are dropped.
+type Tracker interface {
+	Add(ctx context.Context, node string, ttl time.Duration, patterns ...string) error
+	Remove(ctx context.Context, node string, patterns ...string) error
+	// Nodes returns the nodes which subscribe to the patterns matching the topic.
+	Nodes(ctx context.Context, topic string) ([]string, error)
+}
+
+// MemoryTracker tracks the patterns in memory, e.g. for a single node or the tests.
+type MemoryTracker struct {
+	mu        sync.RWMutex
+	patterns  map[string]map[string]time.Time
+	wildcards map[string]struct{}
+}
+
+func NewMemoryTracker() *MemoryTracker {
+	return &MemoryTracker{
+		patterns:  make(map[string]map[string]time.Time),
+		wildcards: make(map[string]struct{}),
+	}
+}
+
+func (t *MemoryTracker) Add(ctx context.Context, node string, ttl time.Duration, patterns ...string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	expiry := time.Now().Add(ttl)
+	for _, pattern := range patterns {
+		if t.patterns[pattern] == nil {
+			t.patterns[pattern] = make(map[string]time.Time)
+			if IsWildcard(pattern) {
+				t.wildcards[pattern] = struct{}{}
+			}
+		}
+		t.patterns[pattern][node] = expiry
+	}
+	return nil
+}
+
+func (t *MemoryTracker) Remove(ctx context.Context, node string, patterns ...string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, pattern := range patterns {
+		delete(t.patterns[pattern], node)
+		if len(t.patterns[pattern]) == 0 {
+			delete(t.patterns, pattern)
+			delete(t.wildcards, pattern)
+		}
+	}
+	return nil
+}
+
+func (t *MemoryTracker) Nodes(ctx context.Context, topic string) ([]string, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	now := time.Now()
+	seen := make(map[string]struct{})
+	var nodes []string
+	add := func(pattern string) {
+		for node, expiry := range t.patterns[pattern] {
+			if _, ok := seen[node]; !ok && expiry.After(now) {
+				seen[node] = struct{}{}
+				nodes = append(nodes, node)
+			}
+		}
+	}
+	add(topic)
+	for pattern := range t.wildcards {
+		if Match(pattern, topic) {
+			add(pattern)
+		}
+	}
+	return nodes, nil
+}
@@ -0,0 +1,142 @@
+package raindrop
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+
+	"github.com/cro4k/raindrop/core"
+	"github.com/cro4k/raindrop/envelope"
+)
+
+const (
+	// CodecParam is the handshake parameter which chooses the codec of a session, e.g. `?codec=msgpack`.
+	CodecParam = "codec"
+	// CodecSubprotocolPrefix is the prefix of the subprotocols which choose the codec of a session,
+	// e.g. `raindrop.msgpack`. The subprotocol takes precedence over the parameter.
+	CodecSubprotocolPrefix = "raindrop."
+)
+
+// CodecSubprotocols returns the subprotocols of the codecs, the listeners should accept them in the handshake.
+func CodecSubprotocols(registry *CodecRegistry) []string {
+	var subprotocols []string
+	for _, name := range registry.Names() {
+		subprotocols = append(subprotocols, CodecSubprotocolPrefix+name)
+	}
+	return subprotocols
+}
+
+// MarshalPayload encodes the value as the payload of the envelope by the codec.
+func MarshalPayload(e *envelope.Envelope, c Codec, v any) error {
+	payload, err := c.Marshal(v)
+	if err != nil {
+		return err
+	}
+	e.Payload = payload
+	e.SetHeader(envelope.HeaderCodec, c.Name())
+	return nil
+}
+
+// UnmarshalPayload decodes the payload of the envelope by the codec in its header, json if there is no header.
+func (r *CodecRegistry) UnmarshalPayload(e *envelope.Envelope, v any) error {
+	name := e.Header(envelope.HeaderCodec)
+	if name == "" {
+		name = CodecJSON
+	}
+	c, err := r.Get(name)
+	if err != nil {
+		return err
+	}
+	return c.Unmarshal(e.GetPayload(), v)
+}
+
+// Transcoder is a core.Interceptor which negotiates the codec of each session during the handshake, and
+// transcodes the outbound envelopes to the codec of the session. The envelopes are encoded in JSON for the
+// json sessions, and in binary for the others. The frames which are not envelopes pass through.
+type Transcoder struct {
+	registry *CodecRegistry
+	fallback Codec
+}
+
+type sessionCodecKey struct{}
+
+// NewTranscoder creates a transcoder, the fallback codec is used when a session does not choose one,
+// it is DefaultCodecs and JSONCodec if they are nil.
+func NewTranscoder(registry *CodecRegistry, fallback Codec) *Transcoder {
+	if registry == nil {
+		registry = DefaultCodecs
+	}
+	if fallback == nil {
+		fallback = JSONCodec{}
+	}
+	return &Transcoder{registry: registry, fallback: fallback}
+}
+
+// SessionCodec returns the codec negotiated by the session.
+func (t *Transcoder) SessionCodec(s *core.Session) Codec {
+	if c, ok := s.Value(sessionCodecKey{}); ok {
+		return c.(Codec)
+	}
+	c := t.negotiate(s)
+	s.SetValue(sessionCodecKey{}, c)
+	return c
+}
+
+func (t *Transcoder) negotiate(s *core.Session) Codec {
+	name, ok := strings.CutPrefix(s.Subprotocol, CodecSubprotocolPrefix)
+	if !ok {
+		name = s.Params.Get(CodecParam)
+	}
+	if name == "" {
+		return t.fallback
+	}
+	c, err := t.registry.Get(name)
+	if err != nil {
+		slog.Warn("unknown codec of session, fallback", slog.String("id", s.ID), slog.String("codec", name))
+		return t.fallback
+	}
+	return c
+}
+
+func (t *Transcoder) Outbound(ctx context.Context, s *core.Session, data []byte) ([]byte, error) {
+	e, format, err := envelope.Decode(data)
+	if err != nil {
+		return data, nil
+	}
+	target := t.SessionCodec(s)
+	targetFormat := envelope.FormatBinary
+	if target.Name() == CodecJSON {
+		targetFormat = envelope.FormatJSON
+	}
+	source := e.Header(envelope.HeaderCodec)
+	if source == "" || source == target.Name() {
+		if format == targetFormat {
+			return data, nil
+		}
+		return envelope.Encode(e, targetFormat)
+	}
+	if err := t.transcode(e, source, target); err != nil {
+		return nil, err
+	}
+	return envelope.Encode(e, targetFormat)
+}
+
+func (t *Transcoder) Inbound(ctx context.Context, s *core.Session, data []byte) ([]byte, error) {
+	return data, nil
+}
+
+func (t *Transcoder) transcode(e *envelope.Envelope, source string, target Codec) error {
+	c, err := t.registry.Get(source)
+	if err != nil {
+		return err
+	}
+	var v any
+	if err := c.Unmarshal(e.GetPayload(), &v); err != nil {
+		return errors.Join(ErrTranscode, err)
+	}
+	if err := MarshalPayload(e, target, v); err != nil {
+		return errors.Join(ErrTranscode, err)
+	}
+	return nil
+}